@@ -0,0 +1,62 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"fmt"
+
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+)
+
+// instances holds the live plugin of each config, for adoption across reloads
+var instances util.InstanceRegistry[*Plugin]
+
+// configKey fingerprints the options that shape the record set. Plugins with the same key
+// load the same records, so one may adopt the other's state.
+func (p *Plugin) configKey() string {
+	// Maps are printed in key order, so the key is deterministic
+	return fmt.Sprintf("%q %d %q %v %d %d %q %q %q", poolKey(p.Driver, p.DataSource), p.TTL, p.NameFormat, p.RolePorts,
+		p.SRVPriority, p.FallbackSRVPriority, p.CollisionPolicy, p.SelfNodeId, p.Exclusion)
+}
+
+// adopt registers the plugin and takes over the loaded records of the plugin it replaces
+// on a reload, if that one had the same config. Otherwise it starts cold.
+func (p *Plugin) adopt() {
+	p.registryKey = p.configKey()
+	prev, ok := instances.Replace(p.registryKey, p)
+	if !ok {
+		return
+	}
+
+	prev.changeMu.Lock()
+	records, changedAt, seeded := prev.lastRecords, prev.changedAt, prev.seeded
+	generation, fingerprint := prev.generation.Load(), prev.fingerprint.Load()
+	prev.changeMu.Unlock()
+	prev.cache.mu.RLock()
+	cached, loadedAt, expiresAt := prev.cache.records, prev.cache.loadedAt, prev.cache.expiresAt
+	prev.cache.mu.RUnlock()
+
+	p.changeMu.Lock()
+	p.lastRecords, p.changedAt, p.seeded = records, changedAt, seeded
+	p.generation.Store(generation)
+	p.fingerprint.Store(fingerprint)
+	p.changeMu.Unlock()
+	p.cache.mu.Lock()
+	p.cache.records, p.cache.loadedAt, p.cache.expiresAt = cached, loadedAt, expiresAt
+	p.cache.mu.Unlock()
+	ilog.Log.Infof("db: adopted %d record(s) at generation %d from the previous instance", len(records), generation)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// exclusionOf returns an exclusion of prefixes
+func exclusionOf(t *testing.T, prefixes ...string) *util.AddressExclusion {
+	t.Helper()
+	e := &util.AddressExclusion{}
+	for _, prefix := range prefixes {
+		_, network, err := net.ParseCIDR(prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Prefixes = append(e.Prefixes, network)
+	}
+	return e
+}
+
+func TestAdopt(t *testing.T) {
+	tests := []struct {
+		name string
+		// change is applied to the config of the new instance
+		change func(t *testing.T, p *Plugin)
+		adopt  bool
+	}{
+		{name: "same config", change: func(t *testing.T, p *Plugin) {}, adopt: true},
+		{name: "changed ttl", change: func(t *testing.T, p *Plugin) { p.TTL++ }},
+		{name: "changed datasource", change: func(t *testing.T, p *Plugin) { p.DataSource += " other" }},
+		{name: "changed name format", change: func(t *testing.T, p *Plugin) { p.NameFormat = "{role}-{node}.{zone}" }},
+		{
+			name:   "same exclude_cidr",
+			change: func(t *testing.T, p *Plugin) { p.Exclusion = exclusionOf(t, "192.0.2.0/24") },
+			adopt:  true,
+		},
+		{
+			name:   "changed exclude_cidr",
+			change: func(t *testing.T, p *Plugin) { p.Exclusion = exclusionOf(t, "198.51.100.0/24") },
+		},
+		{
+			name:   "removed exclude_cidr",
+			change: func(t *testing.T, p *Plugin) { p.Exclusion = nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := util.NewFakeClock(fakeEpoch)
+			config := func(p *Plugin) {
+				p.Clock = clock
+				p.DataSource = "adopt " + t.Name()
+				p.CacheTTL = time.Minute
+				p.Exclusion = exclusionOf(t, "192.0.2.0/24")
+			}
+
+			prev := NewPlugin()
+			config(prev)
+			prev.adopt()
+			t.Cleanup(func() { _ = prev.Close() })
+			records := []util.Record{{FQDN: "n1-management.pce.internal.", Type: dns.TypeA, TTL: 30, Content: util.RecordContent{IP: net.ParseIP("10.1.0.1")}}}
+			prev.trackChanges(records)
+			prev.storeCache(records)
+
+			p := NewPlugin()
+			config(p)
+			tt.change(t, p)
+			p.adopt()
+			t.Cleanup(func() { _ = p.Close() })
+
+			generation, adopted := p.Snapshot()
+			p.cache.mu.RLock()
+			cached, expiresAt := p.cache.records, p.cache.expiresAt
+			p.cache.mu.RUnlock()
+			if !tt.adopt {
+				if generation != 0 || adopted != nil || cached != nil {
+					t.Fatalf("started at generation %d with %d record(s) and %d cached, expected cold", generation, len(adopted), len(cached))
+				}
+				return
+			}
+			if generation != 1 || len(adopted) != 1 || len(cached) != 1 {
+				t.Fatalf("adopted generation %d with %d record(s) and %d cached, expected generation 1 with 1", generation, len(adopted), len(cached))
+			}
+			// The adopted cache is served until it would have expired in the previous instance
+			if !expiresAt.Equal(fakeEpoch.Add(30 * time.Second)) {
+				t.Fatalf("adopted cache expires at %s", expiresAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"golang.org/x/sync/singleflight"
+)
+
+// cacheLoadTimeout bounds a cache refresh, which is shared by every lookup waiting on it
+// and so does not end with the lookup that started it
+const cacheLoadTimeout = 5 * time.Second
+
+// recordCache holds the last loaded record set for CacheTTL
+type recordCache struct {
+	mu sync.RWMutex
+	// records is the cached record set, valid once loadedAt is set
+	records []util.Record
+	// loadedAt is when records was loaded
+	loadedAt time.Time
+	// expiresAt is when records must be reloaded: after CacheTTL, or once the shortest
+	// record TTL has run out, whichever comes first
+	expiresAt time.Time
+
+	// loads collapses concurrent refreshes into a single query
+	loads singleflight.Group
+	// stale is set while the record set is served after a failed refresh
+	stale atomic.Bool
+}
+
+// cachedRecords returns the cached record set and its age, refreshing it once CacheTTL
+// has passed or a record TTL reached zero. If the refresh fails the stale record set is
+// served.
+func (p *Plugin) cachedRecords(ctx context.Context) ([]util.Record, time.Duration, error) {
+	c := &p.cache
+	c.mu.RLock()
+	records, loadedAt, expiresAt := c.records, c.loadedAt, c.expiresAt
+	c.mu.RUnlock()
+	cached := !loadedAt.IsZero()
+	if now := p.Clock.Now(); cached && now.Before(expiresAt) {
+		return records, now.Sub(loadedAt), nil
+	}
+
+	ch := c.loads.DoChan("records", func() (any, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheLoadTimeout)
+		defer cancel()
+		records, err := p.loadNodeRecords(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+		p.storeCache(records)
+		return records, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	case res := <-ch:
+		if res.Err == nil {
+			if c.stale.Swap(false) {
+				ilog.Log.Infof("db: record cache refreshed, no longer serving stale records")
+			}
+			return res.Val.([]util.Record), 0, nil
+		}
+		if !cached {
+			return nil, 0, res.Err
+		}
+		age := util.Since(p.Clock, loadedAt)
+		if !c.stale.Swap(true) {
+			ilog.Log.Warningf("db: failed to refresh record cache, serving records from %s ago: %v", age.Truncate(time.Second), res.Err)
+		}
+		return records, age, nil
+	}
+}
+
+// storeCache replaces the cached record set with records loaded now
+func (p *Plugin) storeCache(records []util.Record) {
+	lifetime := p.CacheTTL
+	for _, r := range records {
+		lifetime = min(lifetime, time.Duration(r.TTL)*time.Second)
+	}
+	now := p.Clock.Now()
+	c := &p.cache
+	c.mu.Lock()
+	c.records, c.loadedAt, c.expiresAt = records, now, now.Add(lifetime)
+	c.mu.Unlock()
+}
+
+// ageRecords decrements the TTLs of records served from the cache by their age. A TTL
+// that runs out is raised to CacheTTLFloor (never above the record's own TTL), so that
+// stale records served while the database is unreachable are not cached downstream for
+// long.
+func (p *Plugin) ageRecords(records []util.Record, age time.Duration) {
+	elapsed := uint32(age / time.Second)
+	if elapsed == 0 {
+		return
+	}
+	for i := range records {
+		ttl := records[i].TTL
+		if ttl > elapsed {
+			records[i].TTL = ttl - elapsed
+		} else {
+			records[i].TTL = 0
+		}
+		if records[i].TTL < p.CacheTTLFloor {
+			records[i].TTL = min(p.CacheTTLFloor, ttl)
+		}
+	}
+}
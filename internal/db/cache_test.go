@@ -0,0 +1,216 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/lib/pq"
+)
+
+// lookupTTL looks up the records of address and returns their TTL
+func lookupTTL(t *testing.T, p *Plugin, address string) uint32 {
+	t.Helper()
+	records, err := p.LookupReverse(context.Background(), net.ParseIP(address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 {
+		t.Fatalf("no records for %s", address)
+	}
+	for _, r := range records[1:] {
+		if r.TTL != records[0].TTL {
+			t.Fatalf("records of %s have TTLs %d and %d", address, records[0].TTL, r.TTL)
+		}
+	}
+	return records[0].TTL
+}
+
+func TestCacheTTLDecrement(t *testing.T) {
+	p, mock, clock := newMockPlugin(t)
+	p.CacheTTL = time.Minute
+	expectNodeRecords(mock, nodeRow("n1", "10.1.0.1"))
+
+	if ttl := lookupTTL(t, p, "10.1.0.1"); ttl != p.TTL {
+		t.Fatalf("fresh record has TTL %d, expected %d", ttl, p.TTL)
+	}
+	// A record cached 25 seconds ago with TTL 30 is served with TTL 5
+	clock.Advance(25 * time.Second)
+	if ttl := lookupTTL(t, p, "10.1.0.1"); ttl != 5 {
+		t.Fatalf("cached record has TTL %d, expected 5", ttl)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheTTLExpiryRefresh(t *testing.T) {
+	p, mock, clock := newMockPlugin(t)
+	// The record TTL runs out before CacheTTL
+	p.CacheTTL = time.Hour
+	expectNodeRecords(mock, nodeRow("n1", "10.1.0.1"))
+	lookupTTL(t, p, "10.1.0.1")
+
+	clock.Advance(29 * time.Second)
+	if ttl := lookupTTL(t, p, "10.1.0.1"); ttl != 1 {
+		t.Fatalf("cached record has TTL %d, expected 1", ttl)
+	}
+	// At zero the record set is reloaded rather than served
+	clock.Advance(time.Second)
+	expectNodeRecords(mock, nodeRow("n1", "10.1.0.1"))
+	if ttl := lookupTTL(t, p, "10.1.0.1"); ttl != p.TTL {
+		t.Fatalf("refreshed record has TTL %d, expected %d", ttl, p.TTL)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expired record set was not reloaded: %v", err)
+	}
+}
+
+func TestCacheTTLFloor(t *testing.T) {
+	p, mock, clock := newMockPlugin(t)
+	p.CacheTTL = time.Minute
+	p.CacheTTLFloor = 10
+	expectNodeRecords(mock, nodeRow("n1", "10.1.0.1"))
+	lookupTTL(t, p, "10.1.0.1")
+
+	// Above the floor the TTL is decremented as usual
+	clock.Advance(15 * time.Second)
+	if ttl := lookupTTL(t, p, "10.1.0.1"); ttl != 15 {
+		t.Fatalf("cached record has TTL %d, expected 15", ttl)
+	}
+	clock.Advance(10 * time.Second)
+	if ttl := lookupTTL(t, p, "10.1.0.1"); ttl != 10 {
+		t.Fatalf("cached record has TTL %d, expected the floor of 10", ttl)
+	}
+
+	// Stale records served when the refresh fails keep the floor
+	clock.Advance(10 * time.Second)
+	mock.ExpectQuery("FROM node_addresses").WillReturnError(&pq.Error{Code: "XX000"})
+	if ttl := lookupTTL(t, p, "10.1.0.1"); ttl != 10 {
+		t.Fatalf("stale record has TTL %d, expected the floor of 10", ttl)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAgeRecordsFloorBelowTTL(t *testing.T) {
+	p := NewPlugin()
+	p.CacheTTLFloor = 10
+	records := []util.Record{{TTL: 5}, {TTL: 60}}
+	p.ageRecords(records, 20*time.Second)
+	// The floor never raises a TTL above the record's own
+	if records[0].TTL != 5 || records[1].TTL != 40 {
+		t.Fatalf("aged TTLs %d and %d, expected 5 and 40", records[0].TTL, records[1].TTL)
+	}
+}
+
+// lookupConcurrently looks up address from n goroutines at once and returns the number of
+// records each got
+func lookupConcurrently(t *testing.T, p *Plugin, address string, n int) []int {
+	t.Helper()
+	start := make(chan struct{})
+	counts := make([]int, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			records, err := p.LookupReverse(context.Background(), net.ParseIP(address))
+			counts[i], errs[i] = len(records), err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return counts
+}
+
+func TestCacheConcurrentRefresh(t *testing.T) {
+	p, mock, clock := newMockPlugin(t)
+	p.CacheTTL = time.Minute
+
+	// The lookups arriving while the query runs wait for it instead of querying again
+	mock.ExpectQuery("FROM node_addresses").
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows(nodeRecordColumns).AddRow(nodeRow("n1", "10.1.0.1")...))
+	for i, n := range lookupConcurrently(t, p, "10.1.0.1", 20) {
+		if n == 0 {
+			t.Fatalf("lookup %d got no records", i)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once expired, a single refresh is made again
+	clock.Advance(time.Minute)
+	mock.ExpectQuery("FROM node_addresses").
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows(nodeRecordColumns).AddRow(nodeRow("n1", "10.1.0.1")...))
+	lookupConcurrently(t, p, "10.1.0.1", 20)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheStaleOnRefreshFailure(t *testing.T) {
+	p, mock, clock := newMockPlugin(t)
+	p.CacheTTL = time.Minute
+	expectNodeRecords(mock, nodeRow("n1", "10.1.0.1"))
+	lookupTTL(t, p, "10.1.0.1")
+	if stale := p.Stale(); stale != "" {
+		t.Fatalf("fresh record set reported %q", stale)
+	}
+
+	// Every lookup waiting on the failed refresh gets the stale record set
+	clock.Advance(time.Minute)
+	mock.ExpectQuery("FROM node_addresses").
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnError(&pq.Error{Code: "XX000"})
+	for i, n := range lookupConcurrently(t, p, "10.1.0.1", 20) {
+		if n == 0 {
+			t.Fatalf("lookup %d got no stale records", i)
+		}
+	}
+	if stale := p.Stale(); stale != util.StaleCache {
+		t.Fatalf("stale record set reported %q, expected %q", stale, util.StaleCache)
+	}
+
+	// The next successful refresh serves current records again
+	expectNodeRecords(mock, nodeRow("n1", "10.1.0.1"))
+	if ttl := lookupTTL(t, p, "10.1.0.1"); ttl != p.TTL {
+		t.Fatalf("refreshed record has TTL %d, expected %d", ttl, p.TTL)
+	}
+	if stale := p.Stale(); stale != "" {
+		t.Fatalf("refreshed record set reported %q", stale)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -18,89 +18,465 @@ package db
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"net"
+	"syscall"
+	"time"
 
 	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
 	"github.com/PextraCloud/pce-coredns/internal/util"
 	"github.com/lib/pq"
 	"github.com/miekg/dns"
 )
 
-const nodeRecordsQuery = `SELECT
+// nodeRecordsQueryFmt is the node records query, with the expressions selecting the
+// optional nodes columns and the join of the nodes table left to fill in, since older
+// schemas lack the columns and DNS-only installs lack the table
+const nodeRecordsQueryFmt = `SELECT
 	node_addresses.node_id,
 	HOST(node_addresses.address) AS address,
 	FAMILY(node_addresses.address) AS address_family,
 	node_addresses.is_default,
+	%[1]s AS dns_hidden,
+	%[2]s AS dns_disabled,
+	%[3]s AS dns_ttl,
 	COALESCE(ARRAY_REMOVE(ARRAY_AGG(node_address_roles.role), NULL), ARRAY[]::text[]) AS address_roles
-FROM node_addresses
+FROM node_addresses%[4]s
 	LEFT JOIN node_address_roles ON node_addresses.id = node_address_roles.node_address_id
 GROUP BY
 	node_addresses.node_id,
 	address,
 	address_family,
-	node_addresses.is_default;`
+	node_addresses.is_default,
+	dns_hidden,
+	dns_disabled,
+	dns_ttl;`
+
+// nodeColumns records which of the nodes table and its optional columns exist
+type nodeColumns struct {
+	table, hidden, disabled, ttl bool
+}
+
+// defaultNodeColumns are assumed until the schema is detected
+var defaultNodeColumns = nodeColumns{table: true, hidden: true, disabled: true}
+
+// query returns the node records query reading the existing columns, and the defaults
+// (visible, enabled, zone TTL) for the missing ones
+func (c nodeColumns) query() string {
+	hidden, disabled, ttl, join := "false", "false", "NULL::bigint", ""
+	if c.table {
+		join = "\n\tLEFT JOIN nodes ON node_addresses.node_id = nodes.id"
+		if c.hidden {
+			hidden = "COALESCE(nodes.dns_hidden, false)"
+		}
+		if c.disabled {
+			disabled = "COALESCE(nodes.dns_disabled, false)"
+		}
+		if c.ttl {
+			ttl = "nodes.dns_ttl::bigint"
+		}
+	}
+	return fmt.Sprintf(nodeRecordsQueryFmt, hidden, disabled, ttl, join)
+}
+
+// legacyNodeRecordsQuery reads schemas from before node addresses and roles existed,
+// where a node has a single address. It yields the same columns as nodeRecordsQuery,
+// with the address as the node's default and no assigned roles.
+const legacyNodeRecordsQuery = `SELECT
+	nodes.id AS node_id,
+	HOST(nodes.ip_address) AS address,
+	FAMILY(nodes.ip_address) AS address_family,
+	true AS is_default,
+	false AS dns_hidden,
+	false AS dns_disabled,
+	NULL::bigint AS dns_ttl,
+	ARRAY[]::text[] AS address_roles
+FROM nodes
+WHERE nodes.ip_address IS NOT NULL;`
+
+// schemaProbeQuery checks whether the role-aware node_addresses table, the nodes table
+// and its optional columns exist
+const schemaProbeQuery = `SELECT
+	EXISTS (
+		SELECT 1 FROM information_schema.tables
+		WHERE table_name = 'node_addresses' AND table_schema = ANY(current_schemas(false))
+	),
+	EXISTS (
+		SELECT 1 FROM information_schema.tables
+		WHERE table_name = 'nodes' AND table_schema = ANY(current_schemas(false))
+	),
+	EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_name = 'nodes' AND column_name = 'dns_hidden' AND table_schema = ANY(current_schemas(false))
+	),
+	EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_name = 'nodes' AND column_name = 'dns_disabled' AND table_schema = ANY(current_schemas(false))
+	),
+	EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_name = 'nodes' AND column_name = 'dns_ttl' AND table_schema = ANY(current_schemas(false))
+	);`
+
+// Schema modes
+const (
+	schemaRoles  = "roles"
+	schemaLegacy = "legacy"
+)
+
+// detectSchema selects the node records query matching the database schema. If the probe
+// fails the role-aware query is kept.
+func (p *Plugin) detectSchema(ctx context.Context, db *sql.DB) {
+	var hasAddresses bool
+	var cols nodeColumns
+	if err := db.QueryRowContext(ctx, schemaProbeQuery).Scan(&hasAddresses, &cols.table, &cols.hidden, &cols.disabled, &cols.ttl); err != nil {
+		ilog.Log.Warningf("db: failed to detect schema, assuming %s: %v", schemaRoles, err)
+		return
+	}
+	if prev := p.nodeColumns.Swap(&cols); prev == nil || *prev != cols {
+		if hasAddresses && !cols.table {
+			ilog.Log.Warningf("db: nodes table missing, serving node addresses without per-node settings")
+		}
+		ilog.Log.Infof("db: optional node columns available: dns_hidden=%t dns_disabled=%t dns_ttl=%t", cols.hidden, cols.disabled, cols.ttl)
+	}
+	legacy := !hasAddresses
+	changed := p.legacySchema.Swap(legacy) != legacy
+	if first := !p.schemaDetected.Swap(true); first || changed {
+		mode := schemaRoles
+		if legacy {
+			mode = schemaLegacy
+		}
+		ilog.Log.Infof("db: using %s schema", mode)
+	}
+	metrics.DBSchemaMode.WithLabelValues(schemaRoles).Set(boolToFloat(!legacy))
+	metrics.DBSchemaMode.WithLabelValues(schemaLegacy).Set(boolToFloat(legacy))
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Nodes serving a role from an explicitly assigned address are preferred over nodes
+// serving it from their default address
+const (
+	defaultSRVPriority         = 10
+	defaultFallbackSRVPriority = 20
+	defaultSRVWeight           = 10
+)
+
+// selfFqdn resolves to the default address of the node this instance runs on
+var selfFqdn = "self." + util.ZoneDynamic
 
 type nodeRecord struct {
 	Address       string
 	AddressFamily string
 	IsDefault     bool
-	Roles         []string
+	// TTL overrides the default TTL for the node's records (0 for the default)
+	TTL uint32
+	// Hidden nodes keep their own names but are left out of shared names (SRV)
+	Hidden bool
+	// Disabled nodes are not served at all
+	Disabled bool
+	// Fallback records are synthesized for roles served from the node's default address
+	Fallback bool
+	Roles    []string
 }
 type defaultAddressMapV struct {
 	Address       string
 	AddressFamily string
+	TTL           uint32
 }
 
-func getFqdnsForNode(nodeId string, roles []string) []string {
+func getFqdnsForNode(format, nodeId string, roles []string) []string {
+	if err := util.CheckLabel(nodeId); err != nil {
+		ilog.Log.Warningf("db: rejecting node %q: node id %v", nodeId, err)
+		metrics.InvalidNames.WithLabelValues(util.SourceDB).Inc()
+		return nil
+	}
 	fqdns := []string{}
 	for _, role := range roles {
-		// <nodeId>-<role>.pce.internal.
-		fqdns = append(fqdns, dns.CanonicalName(fmt.Sprintf("%s-%s.%s", nodeId, role, util.ZoneDynamic)))
+		if err := util.CheckLabel(role); err != nil {
+			ilog.Log.Warningf("db: rejecting role %q of node %q: role %v", role, nodeId, err)
+			metrics.InvalidNames.WithLabelValues(util.SourceDB).Inc()
+			continue
+		}
+		// <nodeId>-<role>.pce.internal. by default
+		fqdn := expandNameFormat(format, nodeId, role)
+		if _, ok := dns.IsDomainName(fqdn); !ok {
+			// Over 255 octets, a label over 63 octets, or an empty label
+			ilog.Log.Warningf("db: skipping invalid name %q for node %q role %q", fqdn, nodeId, role)
+			metrics.InvalidNames.WithLabelValues(util.SourceDB).Inc()
+			continue
+		}
+		if dns.IsSubDomain(util.ZoneBootstrap, fqdn) {
+			// The most specific zone answers exclusively, so the name could never be served
+			ilog.Log.Warningf("db: skipping name %q for node %q role %q, it is shadowed by zone %s", fqdn, nodeId, role, util.ZoneBootstrap)
+			metrics.InvalidNames.WithLabelValues(util.SourceDB).Inc()
+			continue
+		}
+		fqdns = append(fqdns, fqdn)
 	}
 	return fqdns
 }
 
-func (p *Plugin) loadNodeRecords(ctx context.Context) ([]util.Record, error) {
-	if p.db == nil {
-		p.Connect()
+func (p *Plugin) loadNodeRecords(ctx context.Context) (records []util.Record, err error) {
+	if err := ctx.Err(); err != nil {
+		// Client already gave up, don't start any database work
+		return nil, err
 	}
-	if p.db == nil {
-		return nil, fmt.Errorf("db connection not initialized")
+	defer func() { p.trackFailure(ctx, err) }()
+	db, err := p.conn(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	rows, err := p.queryNodeRecords(ctx)
+	release, err := p.acquireQuerySlot(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	defer release()
 
-	nodeRecordsMap, defaultAddressMap, err := scanNodeRecords(rows)
+	start := p.Clock.Now()
+	nodeRecordsMap, defaultAddressMap, err := p.fetchNodeRecords(ctx, db)
+	p.observeQuery("node_records", util.Since(p.Clock, start), nodeRecordsMap)
+	if err != nil && isTransient(err) {
+		nodeRecordsMap, defaultAddressMap, err = p.retryTransient(ctx, db, err)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	records, err := buildDNSRecords(nodeRecordsMap, defaultAddressMap)
+	records, err = p.buildDNSRecords(nodeRecordsMap, defaultAddressMap)
 	if err != nil {
 		return nil, err
 	}
+	records = append(records, p.selfRecords(defaultAddressMap)...)
+	for i := range records {
+		records[i].Source = util.SourceDB
+	}
+	records = p.Exclusion.Apply(util.SourceDB, records)
 
+	ilog.Log.Debugf("db: loaded %d record(s)", len(records))
+	p.trackChanges(records)
+	return records, nil
+}
+
+// fetchNodeRecords queries and scans the node address rows
+func (p *Plugin) fetchNodeRecords(ctx context.Context, db *sql.DB) (map[string][]nodeRecord, map[string]defaultAddressMapV, error) {
+	parent := ctx
+	if p.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.QueryTimeout)
+		defer cancel()
+	}
+	// timedOut reports whether the query failed for running out of QueryTimeout, rather
+	// than for the caller giving up
+	timedOut := func() bool {
+		return ctx.Err() != nil && parent.Err() == nil
+	}
+
+	query := p.recordsQuery()
+	rows, err := queryNodeRecords(ctx, db, query)
+	if isSchemaChanged(err) {
+		// A migration changed the node tables since the schema was detected, e.g. dropped
+		// nodes or one of its columns: detect it again rather than serving an empty zone
+		p.detectSchema(ctx, db)
+		if retry := p.recordsQuery(); retry != query {
+			rows, err = queryNodeRecords(ctx, db, retry)
+		}
+	}
+	switch {
+	case isMissingRelation(err):
+		// DNS-only installs have no node tables, serve an empty zone rather than failing
+		p.warnSchemaMissing(err)
+		return map[string][]nodeRecord{}, map[string]defaultAddressMapV{}, nil
+	case err != nil && timedOut():
+		return nil, nil, p.queryTimedOut()
+	case err != nil:
+		p.queryFailed(ctx, err)
+		return nil, nil, &QueryError{Err: err}
+	}
+	defer rows.Close()
+
+	nodeRecordsMap, defaultAddressMap, err := scanNodeRecords(rows)
+	if err != nil && timedOut() {
+		return nil, nil, p.queryTimedOut()
+	}
+	if err != nil {
+		return nil, nil, &QueryError{Err: err}
+	}
 	if err := rows.Err(); err != nil {
 		ilog.Log.Errorf("db: rows error while loading records: %v", err)
-		return nil, err
+		return nil, nil, &QueryError{Err: err}
 	}
+	metrics.DBSchemaMissing.Set(0)
+	return nodeRecordsMap, defaultAddressMap, nil
+}
 
-	ilog.Log.Debugf("db: loaded %d record(s)", len(records))
-	return records, nil
+// recordsQuery returns the node records query for the detected schema
+func (p *Plugin) recordsQuery() string {
+	if p.legacySchema.Load() {
+		return legacyNodeRecordsQuery
+	}
+	cols := defaultNodeColumns
+	if detected := p.nodeColumns.Load(); detected != nil {
+		cols = *detected
+	}
+	return cols.query()
 }
 
-func (p *Plugin) queryNodeRecords(ctx context.Context) (*sql.Rows, error) {
-	rows, err := p.db.QueryContext(ctx, nodeRecordsQuery)
+// queryTimedOut reports a query that ran out of QueryTimeout
+func (p *Plugin) queryTimedOut() error {
+	ilog.Log.Warningf("db: node records query timed out after %s", p.QueryTimeout)
+	metrics.DBQueryTimeouts.Inc()
+	return &QueryError{Err: ErrQueryTimeout}
+}
+
+// isTransient reports whether a failed query is likely to succeed if retried right away:
+// serialization failures, which include conflicts with recovery on replicas, deadlocks,
+// and connections dropped mid-query
+func isTransient(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// retryTransient retries a load that failed with a transient error once, after
+// transientRetryDelay
+func (p *Plugin) retryTransient(ctx context.Context, db *sql.DB, err error) (map[string][]nodeRecord, map[string]defaultAddressMapV, error) {
+	ilog.Log.Warningf("db: transient query error, retrying once: %v", err)
+	select {
+	case <-ctx.Done():
+		metrics.DBRetries.WithLabelValues("aborted").Inc()
+		return nil, nil, err
+	case <-p.Clock.After(transientRetryDelay):
+	}
+
+	start := p.Clock.Now()
+	nodeRecordsMap, defaultAddressMap, err := p.fetchNodeRecords(ctx, db)
+	p.observeQuery("node_records", util.Since(p.Clock, start), nodeRecordsMap)
 	if err != nil {
+		metrics.DBRetries.WithLabelValues("failure").Inc()
+		return nil, nil, err
+	}
+	metrics.DBRetries.WithLabelValues("success").Inc()
+	return nodeRecordsMap, defaultAddressMap, nil
+}
+
+// observeQuery records the duration of a query, logging it if it exceeded SlowQueryThreshold
+func (p *Plugin) observeQuery(query string, took time.Duration, nodeRecordsMap map[string][]nodeRecord) {
+	metrics.DBQueryDuration.WithLabelValues(query).Observe(took.Seconds())
+	if p.SlowQueryThreshold <= 0 || took < p.SlowQueryThreshold {
+		return
+	}
+	rows := 0
+	for _, records := range nodeRecordsMap {
+		rows += len(records)
+	}
+	ilog.Log.Warningf("db: slow query %s took %s (%d rows)", query, took, rows)
+	metrics.SlowQueries.WithLabelValues(query).Inc()
+}
+
+// trackChanges bumps the generation and logs the differences when the loaded record set
+// differs from the previous load
+func (p *Plugin) trackChanges(records []util.Record) {
+	fp := fingerprintRecords(records)
+	if p.fingerprint.Load() == fp {
+		return
+	}
+
+	p.changeMu.Lock()
+	defer p.changeMu.Unlock()
+	if p.fingerprint.Swap(fp) == fp {
+		// Another load already recorded this change
+		return
+	}
+	generation := p.generation.Add(1)
+	if generation > 1 {
+		diff := util.DiffRecords(p.lastRecords, records)
+		diff.Log(util.SourceDB)
+		if p.OnChange != nil {
+			p.OnChange(util.SourceDB, generation, diff)
+		}
+	}
+	p.lastRecords = records
+	// Real data from now on
+	p.seeded = nil
+	p.changedAt = p.Clock.Now()
+	metrics.SnapshotGeneration.WithLabelValues(util.SourceDB).Set(float64(generation))
+	util.ReportRecordSet(util.SourceDB, records, p.SoftLimit)
+}
+
+// fingerprintRecords returns an order-independent hash of the record set
+func fingerprintRecords(records []util.Record) uint64 {
+	var sum uint64
+	for _, r := range records {
+		h := fnv.New64a()
+		h.Write([]byte(r.String()))
+		sum += h.Sum64()
+	}
+	return sum
+}
+
+// acquireQuerySlot waits briefly for a free query slot, returning a func that frees it
+func (p *Plugin) acquireQuerySlot(ctx context.Context) (func(), error) {
+	waitCtx, cancel := context.WithTimeout(ctx, queryWaitTimeout)
+	defer cancel()
+	if err := p.querySem.Acquire(waitCtx, 1); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		ilog.Log.Warningf("db: no free query slot within %s", queryWaitTimeout)
+		return nil, ErrBusy
+	}
+
+	metrics.DBQueriesInFlight.Inc()
+	return func() {
+		metrics.DBQueriesInFlight.Dec()
+		p.querySem.Release(1)
+	}, nil
+}
+
+func queryNodeRecords(ctx context.Context, db *sql.DB, query string) (*sql.Rows, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil && !isMissingRelation(err) {
 		ilog.Log.Errorf("db: failed to query node records: %v", err)
-		return nil, err
 	}
-	return rows, nil
+	return rows, err
+}
+
+// isMissingRelation reports whether err is Postgres' undefined_table error
+func isMissingRelation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42P01"
+}
+
+// isSchemaChanged reports whether err is Postgres' undefined_table or undefined_column
+// error, raised when the schema no longer matches the detected one
+func isSchemaChanged(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "42P01" || pqErr.Code == "42703")
+}
+
+// warnSchemaMissing flags the missing node tables, logging at most once per schemaWarnInterval
+func (p *Plugin) warnSchemaMissing(err error) {
+	metrics.DBSchemaMissing.Set(1)
+	now := p.Clock.Now().UnixNano()
+	last := p.lastSchemaWarn.Load()
+	if now-last < int64(schemaWarnInterval) || !p.lastSchemaWarn.CompareAndSwap(last, now) {
+		return
+	}
+	ilog.Log.Warningf("db: node tables missing, serving no node records: %v", err)
 }
 
 func scanNodeRecords(rows *sql.Rows) (map[string][]nodeRecord, map[string]defaultAddressMapV, error) {
@@ -111,11 +487,18 @@ func scanNodeRecords(rows *sql.Rows) (map[string][]nodeRecord, map[string]defaul
 
 	for rows.Next() {
 		var nodeId string
+		var ttl sql.NullInt64
 		r := nodeRecord{}
-		if err := rows.Scan(&nodeId, &r.Address, &r.AddressFamily, &r.IsDefault, pq.Array(&r.Roles)); err != nil {
+		if err := rows.Scan(&nodeId, &r.Address, &r.AddressFamily, &r.IsDefault, &r.Hidden, &r.Disabled, &ttl, pq.Array(&r.Roles)); err != nil {
 			ilog.Log.Errorf("db: failed to scan node record: %v", err)
 			return nil, nil, err
 		}
+		if r.Disabled {
+			continue
+		}
+		if ttl.Valid {
+			r.TTL = clampNodeTTL(nodeId, ttl.Int64)
+		}
 
 		// Group records by node ID
 		nodeRecordsMap[nodeId] = append(nodeRecordsMap[nodeId], r)
@@ -125,28 +508,54 @@ func scanNodeRecords(rows *sql.Rows) (map[string][]nodeRecord, map[string]defaul
 			defaultAddressMap[nodeId] = defaultAddressMapV{
 				Address:       r.Address,
 				AddressFamily: r.AddressFamily,
+				TTL:           r.TTL,
 			}
 		}
 	}
 	return nodeRecordsMap, defaultAddressMap, nil
 }
 
-func buildDNSRecords(nodeRecordsMap map[string][]nodeRecord, defaultAddressMap map[string]defaultAddressMapV) ([]util.Record, error) {
-	records := []util.Record{}
+// clampNodeTTL bounds a node's TTL override to 1..util.MaxRecordTTL
+func clampNodeTTL(nodeId string, ttl int64) uint32 {
+	switch {
+	case ttl < 1:
+		ilog.Log.Warningf("db: node %q has TTL %d, using 1", nodeId, ttl)
+		return 1
+	case ttl > util.MaxRecordTTL:
+		ilog.Log.Warningf("db: node %q has TTL %d, using %d", nodeId, ttl, util.MaxRecordTTL)
+		return util.MaxRecordTTL
+	default:
+		return uint32(ttl)
+	}
+}
+
+func (p *Plugin) buildDNSRecords(nodeRecordsMap map[string][]nodeRecord, defaultAddressMap map[string]defaultAddressMapV) ([]util.Record, error) {
+	records := []util.OwnedRecord{}
 	// Process each node's records
 	for nodeId, nodeRecords := range nodeRecordsMap {
+		// Flags are per node, so every row carries the same value
+		hidden := len(nodeRecords) > 0 && nodeRecords[0].Hidden
 		finalNodeRecords := expandRolesWithDefaults(nodeId, nodeRecords, defaultAddressMap)
+		// SRV names are shared between nodes by design
+		if !hidden {
+			for _, rec := range p.buildSRVRecords(nodeId, finalNodeRecords) {
+				records = append(records, util.OwnedRecord{Record: rec})
+			}
+		}
 
 		// Create actual util.Record records for all nodeRecords
 		for _, r := range finalNodeRecords {
-			recs, err := recordsForNodeRecord(nodeId, r)
+			recs, err := p.recordsForNodeRecord(nodeId, r)
 			if err != nil {
 				return nil, err
 			}
-			records = append(records, recs...)
+			for _, rec := range recs {
+				records = append(records, util.OwnedRecord{Record: rec, Owner: nodeId})
+			}
 		}
 	}
-	return records, nil
+	resolved := util.ResolveCollisions(util.SourceDB, records, p.CollisionPolicy)
+	return util.EnforceCNAMEExclusivity(util.SourceDB, resolved), nil
 }
 
 func expandRolesWithDefaults(nodeId string, nodeRecords []nodeRecord, defaultAddressMap map[string]defaultAddressMapV) []nodeRecord {
@@ -165,6 +574,8 @@ func expandRolesWithDefaults(nodeId string, nodeRecords []nodeRecord, defaultAdd
 					Address:       defaultAddr.Address,
 					AddressFamily: defaultAddr.AddressFamily,
 					IsDefault:     true,
+					Fallback:      true,
+					TTL:           defaultAddr.TTL,
 					Roles:         []string{role},
 				})
 			}
@@ -174,31 +585,116 @@ func expandRolesWithDefaults(nodeId string, nodeRecords []nodeRecord, defaultAdd
 	return nodeRecords
 }
 
-func recordsForNodeRecord(nodeId string, r nodeRecord) ([]util.Record, error) {
-	fqdns := getFqdnsForNode(nodeId, r.Roles)
+func (p *Plugin) recordsForNodeRecord(nodeId string, r nodeRecord) ([]util.Record, error) {
+	return p.recordsForFqdns(getFqdnsForNode(p.NameFormat, nodeId, r.Roles), nodeId, r)
+}
+
+func (p *Plugin) recordsForFqdns(fqdns []string, nodeId string, r nodeRecord) ([]util.Record, error) {
 	ip := net.ParseIP(r.Address)
 	if ip == nil {
 		ilog.Log.Warningf("db: skipping node %q with invalid IP %q", nodeId, r.Address)
 		return nil, nil
 	}
 
+	ttl := p.TTL
+	if r.TTL > 0 {
+		ttl = r.TTL
+	}
 	switch r.AddressFamily {
 	case "4":
-		return buildIPRecords(fqdns, dns.TypeA, ip), nil
+		return buildIPRecords(fqdns, dns.TypeA, ip, ttl), nil
 	case "6":
-		return buildIPRecords(fqdns, dns.TypeAAAA, ip), nil
+		return buildIPRecords(fqdns, dns.TypeAAAA, ip, ttl), nil
 	default:
 		return nil, fmt.Errorf("unknown address family %q for node %q", r.AddressFamily, nodeId)
 	}
 }
 
-func buildIPRecords(fqdns []string, recordType uint16, ip net.IP) []util.Record {
+// getSRVFqdnForRole returns the SRV owner name for a role, _<role>._tcp.pce.internal.
+func getSRVFqdnForRole(role string) string {
+	return dns.CanonicalName(fmt.Sprintf("_%s._tcp.%s", role, util.ZoneDynamic))
+}
+
+// buildSRVRecords emits one SRV record per role of the node that has a configured port,
+// targeting the node's role FQDN. Roles served from the default address fallback get the
+// lower preference FallbackSRVPriority.
+func (p *Plugin) buildSRVRecords(nodeId string, nodeRecords []nodeRecord) []util.Record {
+	if len(p.RolePorts) == 0 {
+		return nil
+	}
+
+	records := []util.Record{}
+	// A role may be served from several addresses, but only needs one SRV target
+	seen := map[string]struct{}{}
+	for _, r := range nodeRecords {
+		for _, role := range r.Roles {
+			port, ok := p.RolePorts[role]
+			if !ok {
+				continue
+			}
+			if _, dup := seen[role]; dup {
+				continue
+			}
+			seen[role] = struct{}{}
+			targets := getFqdnsForNode(p.NameFormat, nodeId, []string{role})
+			if len(targets) == 0 {
+				continue
+			}
+
+			priority := p.SRVPriority
+			if r.Fallback {
+				priority = p.FallbackSRVPriority
+			}
+			records = append(records, util.Record{
+				FQDN: getSRVFqdnForRole(role),
+				Type: dns.TypeSRV,
+				TTL:  p.TTL,
+				Content: util.RecordContent{
+					Priority: priority,
+					Weight:   defaultSRVWeight,
+					Port:     port,
+					Target:   targets[0],
+				},
+			})
+		}
+	}
+	return records
+}
+
+// selfRecords builds self.pce.internal. from the default address of the configured node
+func (p *Plugin) selfRecords(defaultAddressMap map[string]defaultAddressMapV) []util.Record {
+	if p.SelfNodeId == "" {
+		return nil
+	}
+
+	defaultAddr, ok := defaultAddressMap[p.SelfNodeId]
+	if !ok {
+		if !p.selfMissingLogged.Swap(true) {
+			ilog.Log.Warningf("db: self node %q has no default address, not serving %s", p.SelfNodeId, selfFqdn)
+		}
+		return nil
+	}
+	p.selfMissingLogged.Store(false)
+
+	recs, err := p.recordsForFqdns([]string{selfFqdn}, p.SelfNodeId, nodeRecord{
+		Address:       defaultAddr.Address,
+		AddressFamily: defaultAddr.AddressFamily,
+		TTL:           defaultAddr.TTL,
+	})
+	if err != nil {
+		ilog.Log.Warningf("db: failed to build self records: %v", err)
+		return nil
+	}
+	return recs
+}
+
+func buildIPRecords(fqdns []string, recordType uint16, ip net.IP, ttl uint32) []util.Record {
 	records := make([]util.Record, 0, len(fqdns))
 	for _, fqdn := range fqdns {
 		records = append(records, util.Record{
 			FQDN: fqdn,
 			Type: recordType,
-			TTL:  30,
+			TTL:  ttl,
 			Content: util.RecordContent{
 				IP: ip,
 			},
@@ -207,34 +703,135 @@ func buildIPRecords(fqdns []string, recordType uint16, ip net.IP) []util.Record
 	return records
 }
 
-func (p *Plugin) LookupRecords(ctx context.Context, name string, qtype uint16) ([]util.Record, bool, error) {
-	// TODO: cache to avoid hitting DB on every query
+// records returns the record set and its age, from the cache if CacheTTL is set. It falls
+// back to the seeded records while the database has not answered yet.
+func (p *Plugin) records(ctx context.Context) ([]util.Record, time.Duration, error) {
+	if p.paused.Load() {
+		p.changeMu.Lock()
+		last := p.lastRecords
+		p.changeMu.Unlock()
+		if last != nil {
+			return last, 0, nil
+		}
+		// Nothing was loaded before the pause, the database is still queried
+	}
+	var records []util.Record
+	var age time.Duration
+	var err error
+	if p.CacheTTL > 0 {
+		records, age, err = p.cachedRecords(ctx)
+	} else {
+		records, err = p.loadNodeRecords(ctx)
+	}
+	if err == nil || ctx.Err() != nil {
+		return records, age, err
+	}
+	p.changeMu.Lock()
+	seeded := p.seeded
+	p.changeMu.Unlock()
+	if seeded == nil {
+		return nil, 0, err
+	}
+	ilog.Log.Debugf("db: serving seeded records: %v", err)
+	return seeded, 0, nil
+}
+
+// Stale reports whether lookups are answered from seeded records, or from a cached
+// record set the database failed to refresh
+func (p *Plugin) Stale() string {
+	p.changeMu.Lock()
+	seeded := p.seeded != nil
+	p.changeMu.Unlock()
+	switch {
+	case seeded:
+		return util.StaleSeeded
+	case p.cache.stale.Load():
+		return util.StaleCache
+	}
+	return ""
+}
+
+// SetPaused stops or resumes querying the database. While paused, lookups are answered
+// from the last loaded record set.
+func (p *Plugin) SetPaused(paused bool) {
+	p.paused.Store(paused)
+}
+
+// Refresh loads the record set now, replacing the cached one
+func (p *Plugin) Refresh(ctx context.Context) error {
 	records, err := p.loadNodeRecords(ctx)
 	if err != nil {
-		ilog.Log.Warningf("db: failed to load records for %q: %v", name, err)
-		return nil, false, err
+		return err
 	}
+	if p.CacheTTL > 0 {
+		p.storeCache(records)
+	}
+	return nil
+}
 
-	nameFqdn := dns.CanonicalName(name)
-	var filtered []util.Record
-	nameExists := false
+// Snapshot returns the last loaded record set and its generation. The records must not
+// be modified.
+func (p *Plugin) Snapshot() (uint64, []util.Record) {
+	p.changeMu.Lock()
+	defer p.changeMu.Unlock()
+	return p.generation.Load(), p.lastRecords
+}
 
-	// Find matches based on FQDN and query type
-	for _, record := range records {
-		if dns.CanonicalName(record.FQDN) != nameFqdn {
-			continue
-		}
-		nameExists = true
+// Seed serves records while the database cannot be reached, until it first answers, e.g.
+// from a snapshot on a cold start during an outage
+func (p *Plugin) Seed(records []util.Record) {
+	p.changeMu.Lock()
+	defer p.changeMu.Unlock()
+	if p.generation.Load() > 0 {
+		return
+	}
+	p.seeded = records
+	ilog.Log.Warningf("db: serving %d seeded record(s) while the database is unreachable", len(records))
+}
 
-		if qtype == dns.TypeANY || record.Type == qtype {
-			// Match type if not ANY
-			filtered = append(filtered, record)
-		} else if (qtype == dns.TypeA || qtype == dns.TypeAAAA) && record.Type == dns.TypeCNAME {
-			// Special case: include CNAME records when querying A/AAAA
-			filtered = append(filtered, record)
-		}
+func (p *Plugin) LookupRecords(ctx context.Context, name string, qtype uint16) ([]util.Record, bool, error) {
+	records, age, err := p.records(ctx)
+	if err != nil {
+		ilog.Log.Warningf("db: failed to load records for %q: %v", name, err)
+		return nil, false, err
 	}
 
+	if preferred, ok := p.listenerRecords(ctx, records, name, qtype); ok {
+		p.ageRecords(preferred, age)
+		return preferred, true, nil
+	}
+	filtered, nameExists := util.MatchRecords(records, name, qtype)
+	filtered = p.preferListenerRole(ctx, records, filtered)
+	p.ageRecords(filtered, age)
 	ilog.Log.Debugf("db: lookup matched %d record(s) for name=%q", len(filtered), name)
 	return filtered, nameExists, nil
 }
+
+func (p *Plugin) LookupAddresses(ctx context.Context, names []string) ([]util.Record, error) {
+	records, age, err := p.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+	addresses := util.FilterAddresses(records, names)
+	p.ageRecords(addresses, age)
+	return addresses, nil
+}
+
+func (p *Plugin) LookupReverse(ctx context.Context, ip net.IP) ([]util.Record, error) {
+	records, age, err := p.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+	addresses := util.FilterByIP(records, ip)
+	p.ageRecords(addresses, age)
+	return addresses, nil
+}
+
+// Probe loads the record set and returns its size, for health checks
+func (p *Plugin) Probe(ctx context.Context) (int, error) {
+	records, err := p.loadNodeRecords(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
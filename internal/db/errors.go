@@ -0,0 +1,35 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import "errors"
+
+// ErrNotConnected is returned when no database connection could be established
+var ErrNotConnected = errors.New("db connection not initialized")
+
+// ErrBusy is returned when no query slot became free within the wait budget
+var ErrBusy = errors.New("too many concurrent db queries")
+
+// ErrQueryTimeout is returned when a query does not complete within QueryTimeout
+var ErrQueryTimeout = errors.New("db query timed out")
+
+// QueryError wraps a failure while querying or scanning records
+type QueryError struct {
+	Err error
+}
+
+func (e *QueryError) Error() string { return "db query failed: " + e.Err.Error() }
+func (e *QueryError) Unwrap() error { return e.Err }
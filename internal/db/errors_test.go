@@ -0,0 +1,97 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/lib/pq"
+)
+
+func TestErrorClasses(t *testing.T) {
+	connReset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	tests := []struct {
+		name string
+		err  error
+		// transient errors are retried once right away
+		transient bool
+		// missingRelation errors serve an empty zone
+		missingRelation bool
+		// lost errors mark the connection lost, other query errors keep it
+		lost bool
+	}{
+		{name: "serialization failure", err: &pq.Error{Code: "40001"}, transient: true},
+		{name: "deadlock", err: &pq.Error{Code: "40P01"}, transient: true},
+		{name: "undefined table", err: &pq.Error{Code: "42P01"}, missingRelation: true},
+		{name: "undefined column", err: &pq.Error{Code: "42703"}},
+		{name: "syntax error", err: &pq.Error{Code: "42601"}},
+		{name: "query canceled", err: &pq.Error{Code: "57014"}},
+		{name: "bad connection", err: driver.ErrBadConn, transient: true, lost: true},
+		{name: "connection dropped", err: io.ErrUnexpectedEOF, transient: true, lost: true},
+		{name: "connection reset", err: connReset, transient: true, lost: true},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, lost: true},
+		{name: "wrapped serialization failure", err: fmt.Errorf("load: %w", &pq.Error{Code: "40001"}), transient: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.transient {
+				t.Errorf("isTransient = %t, expected %t", got, tt.transient)
+			}
+			if got := isMissingRelation(tt.err); got != tt.missingRelation {
+				t.Errorf("isMissingRelation = %t, expected %t", got, tt.missingRelation)
+			}
+
+			clock := util.NewFakeClock(fakeEpoch)
+			p := NewPlugin()
+			p.Clock = clock
+			p.state = StateConnected
+			p.queryFailed(context.Background(), tt.err)
+			want := StateConnected
+			if tt.lost {
+				want = StateLost
+			}
+			if got := p.State(); got != want {
+				t.Errorf("state after the error = %s, expected %s", got, want)
+			}
+			// Let the reconnect probe see the closed plugin and exit
+			_ = p.Close()
+			if tt.lost {
+				clock.BlockUntil(1)
+				clock.Advance(connectRetryInterval)
+			}
+		})
+	}
+}
+
+func TestQueryErrorUnwrap(t *testing.T) {
+	err := error(&QueryError{Err: ErrQueryTimeout})
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Fatal("QueryError does not unwrap to its cause")
+	}
+	var queryErr *QueryError
+	if !errors.As(fmt.Errorf("lookup: %w", err), &queryErr) {
+		t.Fatal("wrapped QueryError not found")
+	}
+}
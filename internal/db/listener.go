@@ -0,0 +1,107 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"context"
+	"strings"
+
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// listenerRecords answers self.pce.internal. with the self node's address for the role
+// of the listener the query arrived on (see ListenerRoles), instead of its default
+// address. It reports false when no mapping matches or the node has no record for the
+// role, and the default address is served.
+func (p *Plugin) listenerRecords(ctx context.Context, records []util.Record, name string, qtype uint16) ([]util.Record, bool) {
+	if name != selfFqdn || len(p.ListenerRoles) == 0 {
+		return nil, false
+	}
+	role := util.MatchListenerRole(p.ListenerRoles, util.LocalIP(ctx))
+	if role == "" {
+		return nil, false
+	}
+	fqdns := getFqdnsForNode(p.NameFormat, strings.ToLower(p.SelfNodeId), []string{role})
+	if len(fqdns) == 0 {
+		return nil, false
+	}
+
+	matched, _ := util.MatchRecords(records, fqdns[0], qtype)
+	var results []util.Record
+	for _, r := range matched {
+		if r.Type != dns.TypeA && r.Type != dns.TypeAAAA {
+			continue
+		}
+		r.FQDN = selfFqdn
+		results = append(results, r)
+	}
+	if len(results) == 0 {
+		return nil, false
+	}
+	ilog.Log.Debugf("db: answering %s with the %s address for the listener", selfFqdn, role)
+	return results, true
+}
+
+// preferListenerRole narrows the addresses answering a lookup to those that also serve the
+// role of the listener the query arrived on (see ListenerRoles), so that a name served
+// from several addresses is answered with e.g. the management address on the management
+// listener. All matched records are kept when no mapping or address matches.
+func (p *Plugin) preferListenerRole(ctx context.Context, records, matched []util.Record) []util.Record {
+	if len(p.ListenerRoles) == 0 || len(matched) < 2 {
+		return matched
+	}
+	role := util.MatchListenerRole(p.ListenerRoles, util.LocalIP(ctx))
+	if role == "" {
+		return matched
+	}
+
+	// The role's names are the name format with any node id in place of {node}
+	const placeholder = "\x00"
+	prefix, suffix, ok := strings.Cut(expandNameFormat(p.NameFormat, placeholder, role), placeholder)
+	if !ok || strings.Contains(suffix, placeholder) {
+		return matched
+	}
+	roleAddresses := map[string]struct{}{}
+	for _, r := range records {
+		if r.Type != dns.TypeA && r.Type != dns.TypeAAAA {
+			continue
+		}
+		node, found := strings.CutPrefix(r.FQDN, prefix)
+		if node, found = strings.CutSuffix(node, suffix); found && node != "" && !strings.Contains(node, ".") {
+			roleAddresses[r.Content.IP.String()] = struct{}{}
+		}
+	}
+
+	preferred := make([]util.Record, 0, len(matched))
+	kept := 0
+	for _, r := range matched {
+		if r.Type == dns.TypeA || r.Type == dns.TypeAAAA {
+			if _, ok := roleAddresses[r.Content.IP.String()]; !ok {
+				continue
+			}
+			kept++
+		}
+		preferred = append(preferred, r)
+	}
+	if kept == 0 || len(preferred) == len(matched) {
+		// No address serves the role, or all do
+		return matched
+	}
+	ilog.Log.Debugf("db: preferring %d %s address(es) for the listener", kept, role)
+	return preferred
+}
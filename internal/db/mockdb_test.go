@@ -0,0 +1,95 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+)
+
+// fakeEpoch is the start time of fake clocks in tests
+var fakeEpoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// nodeRecordColumns are the columns of the node records query
+var nodeRecordColumns = []string{"node_id", "address", "address_family", "is_default", "dns_hidden", "dns_disabled", "dns_ttl", "address_roles"}
+
+// nodeRow is a default IPv4 address row of the node records query
+func nodeRow(node, address string) []driver.Value {
+	return []driver.Value{node, address, "4", true, false, false, nil, "{}"}
+}
+
+// fullSchema is the schema probe row of the role-aware schema with every optional column
+var fullSchema = schemaProbe{addresses: true, nodeColumns: nodeColumns{table: true, hidden: true, disabled: true, ttl: true}}
+
+// schemaProbe is the answer to the schema probe query
+type schemaProbe struct {
+	addresses bool
+	nodeColumns
+}
+
+// expectSchemaProbe expects one schema probe query answered with schema
+func expectSchemaProbe(mock sqlmock.Sqlmock, schema schemaProbe) {
+	rows := sqlmock.NewRows([]string{"addresses", "nodes", "dns_hidden", "dns_disabled", "dns_ttl"}).
+		AddRow(schema.addresses, schema.table, schema.hidden, schema.disabled, schema.ttl)
+	mock.ExpectQuery("information_schema").WillReturnRows(rows)
+}
+
+// newMockPlugin returns a plugin connected to a sqlmock database on a fake clock, with
+// the schema probe already answered for the full role-aware schema
+func newMockPlugin(t *testing.T) (*Plugin, sqlmock.Sqlmock, *util.FakeClock) {
+	t.Helper()
+	return newMockPluginWithSchema(t, fullSchema)
+}
+
+// newMockPluginWithSchema is newMockPlugin with the schema probe answered with schema
+func newMockPluginWithSchema(t *testing.T, schema schemaProbe) (*Plugin, sqlmock.Sqlmock, *util.FakeClock) {
+	t.Helper()
+	dsn := "pce " + t.Name()
+	conn, mock, err := sqlmock.NewWithDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectSchemaProbe(mock, schema)
+
+	clock := util.NewFakeClock(fakeEpoch)
+	p := NewPlugin()
+	p.Driver = "sqlmock"
+	p.DataSource = dsn
+	p.Clock = clock
+	p.Connect()
+	t.Cleanup(func() {
+		mock.ExpectClose()
+		_ = p.Close()
+		_ = conn.Close()
+	})
+	if p.State() != StateConnected {
+		t.Fatalf("mock database not connected: %s", p.State())
+	}
+	return p, mock, clock
+}
+
+// expectNodeRecords expects one node records query answered with rows
+func expectNodeRecords(mock sqlmock.Sqlmock, rows ...[]driver.Value) {
+	result := sqlmock.NewRows(nodeRecordColumns)
+	for _, row := range rows {
+		result.AddRow(row...)
+	}
+	mock.ExpectQuery("FROM node_addresses").WillReturnRows(result)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// DefaultNameFormat builds <nodeId>-<role>.pce.internal.
+const DefaultNameFormat = "{node}-{role}.{zone}"
+
+// ValidateNameFormat checks that a name format identifies a node role within the dynamic
+// zone and expands to a legal name. Names inside the nested bootstrap zone are rejected,
+// since that zone answers for them exclusively.
+func ValidateNameFormat(format string) error {
+	for _, placeholder := range []string{"{node}", "{role}"} {
+		if !strings.Contains(format, placeholder) {
+			return fmt.Errorf("name format '%s' must contain %s", format, placeholder)
+		}
+	}
+	if !strings.HasSuffix(format, ".{zone}") {
+		return fmt.Errorf("name format '%s' must end with .{zone}", format)
+	}
+
+	sample := expandNameFormat(format, "node", "role")
+	if _, ok := dns.IsDomainName(sample); !ok {
+		return fmt.Errorf("name format '%s' produces invalid names such as %q", format, sample)
+	}
+	if dns.IsSubDomain(util.ZoneBootstrap, sample) {
+		return fmt.Errorf("name format '%s' produces names inside zone %s such as %q", format, util.ZoneBootstrap, sample)
+	}
+	return nil
+}
+
+// expandNameFormat substitutes the placeholders of a name format
+func expandNameFormat(format, nodeId, role string) string {
+	return dns.CanonicalName(strings.NewReplacer(
+		"{node}", nodeId,
+		"{role}", role,
+		"{zone}", util.ZoneDynamic,
+	).Replace(format))
+}
+
+// NodeFQDN returns the name of a node's role in the dynamic zone
+func (p *Plugin) NodeFQDN(nodeId, role string) (string, bool) {
+	fqdns := getFqdnsForNode(p.NameFormat, strings.ToLower(nodeId), []string{role})
+	if len(fqdns) == 0 {
+		return "", false
+	}
+	return fqdns[0], true
+}
@@ -18,27 +18,152 @@ package db
 import (
 	"context"
 	"database/sql"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	ilog "github.com/PextraCloud/pce-coredns/internal/log"
 	"github.com/PextraCloud/pce-coredns/internal/util"
 	_ "github.com/lib/pq"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// defaultMaxConcurrentQueries bounds how many lookups may query the database at once
+	defaultMaxConcurrentQueries = 32
+	// defaultQueryTimeout is the default QueryTimeout
+	defaultQueryTimeout = 2 * time.Second
+	// defaultCacheTTLFloor is the default CacheTTLFloor
+	defaultCacheTTLFloor = 1
+	// queryWaitTimeout is how long a lookup waits for a free query slot before giving up
+	queryWaitTimeout = 100 * time.Millisecond
+	// transientRetryDelay is how long a load waits before retrying a transient error
+	transientRetryDelay = 100 * time.Millisecond
+	// schemaWarnInterval limits how often missing node tables are reported
+	schemaWarnInterval = time.Minute
 )
 
 type Plugin struct {
+	// Driver is the database/sql driver DataSource is opened with
+	Driver string
 	// DataSource is the database connection string
 	DataSource string
-	// db is the database connection pool
+	// SoftLimit is the record set size in bytes above which a warning is logged (0 for none)
+	SoftLimit int64
+	// TTL is the TTL to set on returned records
+	TTL uint32
+	// NameFormat is the template for node role FQDNs (see DefaultNameFormat)
+	NameFormat string
+	// RolePorts maps roles to the port advertised in their _<role>._tcp SRV records
+	RolePorts map[string]uint16
+	// SRVPriority is the SRV priority of nodes with a role assigned to a dedicated address
+	SRVPriority uint16
+	// FallbackSRVPriority is the SRV priority of nodes serving a role from their default address
+	FallbackSRVPriority uint16
+	// Exclusion keeps addresses within excluded prefixes out of the records (nil for none)
+	Exclusion *util.AddressExclusion
+	// CollisionPolicy decides what is served when two nodes produce the same name
+	CollisionPolicy util.CollisionPolicy
+	// Clock is the source of time for reconnect throttling and query timing
+	Clock util.Clock
+	// SlowQueryThreshold is the duration above which a query is logged as slow (0 for none)
+	SlowQueryThreshold time.Duration
+	// SelfNodeId is the id of the node this instance runs on, served as self.pce.internal.
+	SelfNodeId string
+	// ListenerRoles maps the listeners queries arrive on to the role address served for
+	// self.pce.internal. (the default address when none matches), and preferred among the
+	// addresses of other names
+	ListenerRoles []util.ListenerRole
+	// OnChange is notified when a load changes the records (nil for none). It must be set
+	// before the plugin starts serving.
+	OnChange util.ChangeFunc
+	// QueryTimeout bounds each records query, so that a slow or locked database cannot
+	// hold lookups indefinitely (0 for no limit beyond the caller's)
+	QueryTimeout time.Duration
+	// CacheTTL is how long a loaded record set is served before the database is queried
+	// again (0 queries on every lookup)
+	CacheTTL time.Duration
+	// CacheTTLFloor is the lowest TTL a record served from the cache is aged to, so that
+	// stale records still carry a TTL when the database cannot be reached
+	CacheTTLFloor uint32
+	// stateMu guards state, db, lastConnectAttempt, failUntil and probing
+	stateMu sync.Mutex
+	// state is the state of the database connection
+	state ConnState
+	// db is the database connection pool, set while connected or lost
 	db *sql.DB
 	// lastConnectAttempt is used to throttle reconnect attempts
 	lastConnectAttempt time.Time
+	// failUntil is the end of the fast-fail window, refreshed while connection attempts fail
+	failUntil time.Time
+	// probing is set while the background connection probe runs
+	probing bool
+	// querySem limits the number of in-flight queries
+	querySem *semaphore.Weighted
+	// cache holds the last loaded record set while CacheTTL is set
+	cache recordCache
+
+	// fingerprint identifies the last loaded record set (change detection)
+	fingerprint atomic.Uint64
+	// generation is incremented every time the loaded record set changes
+	generation atomic.Uint64
+	// lastRecords is the last loaded record set (change logging)
+	lastRecords []util.Record
+	// changedAt is when the current generation was loaded
+	changedAt time.Time
+	// seeded is served while the database has never answered (nil for none)
+	seeded []util.Record
+	// changeMu serializes change tracking between concurrent loads, and guards lastRecords,
+	// changedAt and seeded
+	changeMu sync.Mutex
+	// selfMissingLogged avoids repeating the warning for an unknown SelfNodeId
+	selfMissingLogged atomic.Bool
+	// legacySchema selects the query for schemas without node addresses and roles
+	legacySchema atomic.Bool
+	// nodeColumns is the detected nodes table and columns the records query reads (nil
+	// before detection)
+	nodeColumns atomic.Pointer[nodeColumns]
+	// schemaDetected is set once the schema was first detected
+	schemaDetected atomic.Bool
+	// lastSchemaWarn is when missing node tables were last reported (unix nanoseconds)
+	lastSchemaWarn atomic.Int64
+	// registryKey is the key the plugin is registered under for adoption on reload
+	registryKey string
+	// paused serves the last loaded record set without querying the database
+	paused atomic.Bool
+	// everConnected is set once the database first answered a ping
+	everConnected atomic.Bool
+	// failingSince is when loads started failing (unix nanoseconds, 0 while they succeed)
+	failingSince atomic.Int64
 }
 
-// comp-time check: Plugin implements util.Adapter
+// comp-time check: Plugin implements util.Adapter, util.AddressAdapter, util.ReverseAdapter
+// and util.Generational
 var _ util.Adapter = (*Plugin)(nil)
+var _ util.AddressAdapter = (*Plugin)(nil)
+var _ util.ReverseAdapter = (*Plugin)(nil)
+var _ util.Generational = (*Plugin)(nil)
 
 func NewPlugin() *Plugin {
-	return &Plugin{}
+	return &Plugin{
+		Driver:              "postgres",
+		TTL:                 30,
+		NameFormat:          DefaultNameFormat,
+		RolePorts:           map[string]uint16{},
+		SRVPriority:         defaultSRVPriority,
+		FallbackSRVPriority: defaultFallbackSRVPriority,
+		CollisionPolicy:     util.CollisionMerge,
+		Clock:               util.RealClock,
+		QueryTimeout:        defaultQueryTimeout,
+		CacheTTLFloor:       defaultCacheTTLFloor,
+		querySem:            semaphore.NewWeighted(defaultMaxConcurrentQueries),
+	}
+}
+
+// SetMaxConcurrentQueries sets the limit of in-flight queries. It must be called before
+// the plugin starts serving.
+func (p *Plugin) SetMaxConcurrentQueries(n int64) {
+	p.querySem = semaphore.NewWeighted(n)
 }
 
 // Connect establishes a connection to the database
@@ -47,54 +172,88 @@ var sqlOpen = sql.Open
 // Short timeout since connections are local
 const connectTimeout = 2 * time.Second
 
+// connectRetryInterval throttles connection attempts made from the query path
+const connectRetryInterval = 2 * time.Second
+
+// fastFailWindow is how long lookups fail without a connection attempt after one failed.
+// It outlasts a probe interval plus a connect timeout, so it holds while probes keep failing.
+const fastFailWindow = connectRetryInterval + connectTimeout + time.Second
+
 func (p *Plugin) Connect() {
-	// Avoid rapid reconnection attempts
-	if time.Since(p.lastConnectAttempt) < 2*time.Second {
+	if p.DataSource == "" {
+		ilog.Log.Warningf("db: no datasource provided, skipping database connection")
+		return
+	}
+	if err := p.fire(eventConfigure); err != nil {
+		ilog.Log.Warningf("db: %v", err)
 		return
 	}
-	p.lastConnectAttempt = time.Now()
+	p.adopt()
+	p.connect(context.Background())
+}
 
-	if p.DataSource == "" {
-		ilog.Log.Warningf("db: no datasource provided, skipping database connection")
+// claimConnectAttempt reports whether a connection attempt may be made now, throttling
+// attempts to one every connectRetryInterval
+func (p *Plugin) claimConnectAttempt() bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if util.Since(p.Clock, p.lastConnectAttempt) < connectRetryInterval {
+		return false
+	}
+	p.lastConnectAttempt = p.Clock.Now()
+	return true
+}
+
+// connect dials the database, bounding the ping by both connectTimeout and ctx so that
+// reconnects on the query path never outlive the request that triggered them.
+func (p *Plugin) connect(ctx context.Context) {
+	if p.State() != StateDisconnected || !p.claimConnectAttempt() {
 		return
 	}
 
-	ilog.Log.Debugf("db: opening connection")
-	db, err := sqlOpen("postgres", p.DataSource)
+	db, err := acquirePool(ctx, p.Driver, p.DataSource)
 	if err != nil {
-		ilog.Log.Errorf("db: failed to open connection: %v", err)
+		_ = p.fire(eventPingFail)
 		return
 	}
 
-	// Test db connection with a timeout so startup never blocks indefinitely.
-	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
-	defer cancel()
-	if err := db.PingContext(ctx); err != nil {
-		ilog.Log.Warningf("db: failed to ping database: %v", err)
-		_ = db.Close()
+	p.stateMu.Lock()
+	if p.state != StateDisconnected {
+		p.stateMu.Unlock()
+		// Closed, or connected by a concurrent attempt, while dialing
+		_ = releasePool(p.Driver, p.DataSource)
 		return
 	}
-
-	// TODO: make configurable
-	db.SetConnMaxLifetime(time.Minute)
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-
+	_ = p.fireLocked(eventDialSuccess)
 	p.db = db
+	p.stateMu.Unlock()
+
 	ilog.Log.Infof("db: connection established")
+	p.detectSchema(ctx, db)
+}
+
+func (p *Plugin) Generation() uint64 {
+	return p.generation.Load()
+}
+
+// SnapshotAt returns when the current record set generation was loaded
+func (p *Plugin) SnapshotAt() time.Time {
+	p.changeMu.Lock()
+	defer p.changeMu.Unlock()
+	return p.changedAt
 }
 
 func (p *Plugin) Close() error {
-	if p.db == nil {
-		return nil
-	}
+	instances.Remove(p.registryKey, p)
+	p.stateMu.Lock()
+	db := p.db
+	p.db = nil
+	_ = p.fireLocked(eventClose)
+	p.stateMu.Unlock()
 
-	ilog.Log.Infof("db: closing postgres connection")
-	if err := p.db.Close(); err != nil {
-		ilog.Log.Errorf("db: failed to close connection: %v", err)
-		return err
+	if db == nil {
+		return nil
 	}
-
-	ilog.Log.Infof("db: postgres connection closed")
-	return nil
+	// The pool is shared between instances with the same datasource, the last one closes it
+	return releasePool(p.Driver, p.DataSource)
 }
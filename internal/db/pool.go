@@ -0,0 +1,177 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+)
+
+// sharedPool is a connection pool shared by every plugin instance using the same driver
+// and DSN, e.g. when the plugin is declared in several server blocks.
+type sharedPool struct {
+	db   *sql.DB
+	refs int
+	// ready is closed once the first user opened and pinged the pool, after which db or
+	// err is set
+	ready chan struct{}
+	err   error
+}
+
+var pools = struct {
+	sync.Mutex
+	// poolKey -> pool
+	m map[string]*sharedPool
+}{m: map[string]*sharedPool{}}
+
+// normalizeDSN returns a key under which equivalent DSNs compare equal
+func normalizeDSN(dsn string) string {
+	dsn = strings.TrimSpace(dsn)
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return dsn
+		}
+		u.Scheme = "postgres"
+		u.Host = strings.ToLower(u.Host)
+		// Encode sorts by key
+		u.RawQuery = u.Query().Encode()
+		return u.String()
+	}
+	if strings.ContainsAny(dsn, `'\`) {
+		// Quoted values may contain spaces, keep as-is
+		return dsn
+	}
+	// key=value form, order does not matter
+	fields := strings.Fields(dsn)
+	slices.Sort(fields)
+	return strings.Join(fields, " ")
+}
+
+// poolKey returns the registry key of the pool for driverName and dsn
+func poolKey(driverName, dsn string) string {
+	return driverName + " " + normalizeDSN(dsn)
+}
+
+// acquirePool returns the pool for dsn, opening and pinging it if this is the first user.
+// The ping runs outside the registry lock, so a slow database only delays the users of its
+// own DSN. Every successful call must be paired with releasePool.
+func acquirePool(ctx context.Context, driverName, dsn string) (*sql.DB, error) {
+	key := poolKey(driverName, dsn)
+	pools.Lock()
+	if pool, ok := pools.m[key]; ok {
+		pool.refs++
+		refs := pool.refs
+		pools.Unlock()
+		// The first user's ping is bounded by connectTimeout, but our caller may give up sooner
+		select {
+		case <-pool.ready:
+		case <-ctx.Done():
+			pools.Lock()
+			defer pools.Unlock()
+			// A pool that failed to open was already dropped and holds no reference of ours
+			if pools.m[key] == pool {
+				_ = unrefLocked(key, pool)
+			}
+			return nil, ctx.Err()
+		}
+		if pool.err != nil {
+			return nil, pool.err
+		}
+		ilog.Log.Debugf("db: reusing shared connection pool (%d users)", refs)
+		return pool.db, nil
+	}
+	pool := &sharedPool{refs: 1, ready: make(chan struct{})}
+	pools.m[key] = pool
+	pools.Unlock()
+
+	db, err := openPool(ctx, driverName, dsn)
+	pools.Lock()
+	if err != nil {
+		// Users waiting on the pool fail with it and hold no reference
+		delete(pools.m, key)
+		pool.err = err
+	} else {
+		pool.db = db
+	}
+	close(pool.ready)
+	pools.Unlock()
+	return db, err
+}
+
+// openPool opens a connection pool for dsn and checks that the database answers
+func openPool(ctx context.Context, driverName, dsn string) (*sql.DB, error) {
+	ilog.Log.Debugf("db: opening connection")
+	db, err := sqlOpen(driverName, dsn)
+	if err != nil {
+		ilog.Log.Errorf("db: failed to open connection: %v", err)
+		return nil, err
+	}
+
+	// Test db connection with a timeout so startup never blocks indefinitely.
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		ilog.Log.Warningf("db: failed to ping database: %v", err)
+		_ = db.Close()
+		return nil, err
+	}
+
+	// TODO: make configurable
+	db.SetConnMaxLifetime(time.Minute)
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(5)
+	return db, nil
+}
+
+// releasePool drops one reference to the pool for dsn, closing it when the last user is gone
+func releasePool(driverName, dsn string) error {
+	key := poolKey(driverName, dsn)
+	pools.Lock()
+	defer pools.Unlock()
+
+	pool, ok := pools.m[key]
+	if !ok {
+		return nil
+	}
+	return unrefLocked(key, pool)
+}
+
+// unrefLocked drops one reference to pool, closing it when the last user is gone. The
+// registry lock must be held.
+func unrefLocked(key string, pool *sharedPool) error {
+	pool.refs--
+	if pool.refs > 0 {
+		ilog.Log.Debugf("db: shared connection pool still has %d user(s)", pool.refs)
+		return nil
+	}
+	delete(pools.m, key)
+
+	ilog.Log.Infof("db: closing postgres connection")
+	if err := pool.db.Close(); err != nil {
+		ilog.Log.Errorf("db: failed to close connection: %v", err)
+		return err
+	}
+	ilog.Log.Infof("db: postgres connection closed")
+	return nil
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingDriver pings by waiting on the channel registered for the DSN ("" for none)
+type blockingDriver struct {
+	mu    sync.Mutex
+	pings map[string]chan error
+}
+
+type blockingConn struct {
+	driver.Conn
+	ping chan error
+}
+
+func (d *blockingDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return &blockingConn{ping: d.pings[dsn]}, nil
+}
+
+func (c *blockingConn) Ping(ctx context.Context) error {
+	if c.ping == nil {
+		return nil
+	}
+	select {
+	case err := <-c.ping:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *blockingConn) Close() error { return nil }
+
+var testDriver = &blockingDriver{pings: map[string]chan error{}}
+
+func init() {
+	sql.Register("pce-blocking", testDriver)
+}
+
+// useBlockingDriver opens pools with testDriver, pinging dsn through the returned channel
+func useBlockingDriver(t *testing.T, dsn string) chan error {
+	t.Helper()
+	ping := make(chan error)
+	testDriver.mu.Lock()
+	testDriver.pings[dsn] = ping
+	testDriver.mu.Unlock()
+	sqlOpen = func(_, dsn string) (*sql.DB, error) { return sql.Open("pce-blocking", dsn) }
+	t.Cleanup(func() { sqlOpen = sql.Open })
+	return ping
+}
+
+func TestAcquirePoolPingOutsideLock(t *testing.T) {
+	ping := useBlockingDriver(t, "host=slow")
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := acquirePool(context.Background(), "postgres", "host=slow")
+		slow <- err
+	}()
+
+	// Another DSN is not held up by the slow ping
+	fast := make(chan error, 1)
+	go func() {
+		_, err := acquirePool(context.Background(), "postgres", "host=fast")
+		fast <- err
+	}()
+	select {
+	case err := <-fast:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquiring a pool waited on another DSN's ping")
+	}
+	if err := releasePool("postgres", "host=fast"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second user of the slow DSN waits for the first ping and shares its pool
+	shared := make(chan *sql.DB, 1)
+	go func() {
+		db, err := acquirePool(context.Background(), "postgres", "host=slow")
+		if err != nil {
+			t.Error(err)
+		}
+		shared <- db
+	}()
+	ping <- nil
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+	db := <-shared
+	pools.Lock()
+	pool := pools.m[poolKey("postgres", "host=slow")]
+	pools.Unlock()
+	if db == nil || db != pool.db {
+		t.Fatal("second user did not share the pool")
+	}
+	for range 2 {
+		if err := releasePool("postgres", "host=slow"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pools.Lock()
+	_, ok := pools.m[poolKey("postgres", "host=slow")]
+	pools.Unlock()
+	if ok {
+		t.Fatal("pool kept after its last user released it")
+	}
+}
+
+func TestAcquirePoolPingFailure(t *testing.T) {
+	ping := useBlockingDriver(t, "host=down")
+	errDown := errors.New("database is down")
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := acquirePool(context.Background(), "postgres", "host=down")
+		first <- err
+	}()
+	second := make(chan error, 1)
+	go func() {
+		_, err := acquirePool(context.Background(), "postgres", "host=down")
+		second <- err
+	}()
+	// Fail the ping once both users wait on it
+	for {
+		pools.Lock()
+		pool, ok := pools.m[poolKey("postgres", "host=down")]
+		waiting := ok && pool.refs == 2
+		pools.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ping <- errDown
+	for _, ch := range []chan error{first, second} {
+		if err := <-ch; !errors.Is(err, errDown) {
+			t.Fatalf("expected the ping error, got %v", err)
+		}
+	}
+	pools.Lock()
+	_, ok := pools.m[poolKey("postgres", "host=down")]
+	pools.Unlock()
+	if ok {
+		t.Fatal("failed pool kept in the registry")
+	}
+}
+
+func TestAcquirePoolWaitCanceled(t *testing.T) {
+	ping := useBlockingDriver(t, "host=stuck")
+	key := poolKey("postgres", "host=stuck")
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := acquirePool(context.Background(), "postgres", "host=stuck")
+		first <- err
+	}()
+	waitRefs(t, key, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	second := make(chan error, 1)
+	go func() {
+		_, err := acquirePool(ctx, "postgres", "host=stuck")
+		second <- err
+	}()
+	waitRefs(t, key, 2)
+
+	// The waiter gives up without waiting for the ping, and gives its reference back
+	cancel()
+	select {
+	case err := <-second:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("canceled waiter still waiting on the ping")
+	}
+	pools.Lock()
+	refs := pools.m[key].refs
+	pools.Unlock()
+	if refs != 1 {
+		t.Fatalf("pool has %d references after the waiter gave up, expected 1", refs)
+	}
+
+	ping <- nil
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if err := releasePool("postgres", "host=stuck"); err != nil {
+		t.Fatal(err)
+	}
+	pools.Lock()
+	_, ok := pools.m[key]
+	pools.Unlock()
+	if ok {
+		t.Fatal("pool kept after its last user released it")
+	}
+}
+
+// waitRefs waits until the pool under key has refs references
+func waitRefs(t *testing.T, key string, refs int) {
+	t.Helper()
+	for {
+		pools.Lock()
+		pool, ok := pools.m[key]
+		done := ok && pool.refs == refs
+		pools.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
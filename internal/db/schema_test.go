@@ -0,0 +1,184 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func TestNodeColumnsQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		cols     nodeColumns
+		contains []string
+		absent   []string
+	}{
+		{
+			name:     "all columns",
+			cols:     nodeColumns{table: true, hidden: true, disabled: true, ttl: true},
+			contains: []string{"LEFT JOIN nodes", "COALESCE(nodes.dns_hidden, false) AS dns_hidden", "COALESCE(nodes.dns_disabled, false) AS dns_disabled", "nodes.dns_ttl::bigint AS dns_ttl"},
+		},
+		{
+			name:     "no flags",
+			cols:     nodeColumns{table: true, ttl: true},
+			contains: []string{"LEFT JOIN nodes", "false AS dns_hidden", "false AS dns_disabled", "nodes.dns_ttl::bigint AS dns_ttl"},
+			absent:   []string{"nodes.dns_hidden", "nodes.dns_disabled"},
+		},
+		{
+			name:     "hidden only",
+			cols:     nodeColumns{table: true, hidden: true},
+			contains: []string{"COALESCE(nodes.dns_hidden, false) AS dns_hidden", "false AS dns_disabled", "NULL::bigint AS dns_ttl"},
+			absent:   []string{"nodes.dns_disabled", "nodes.dns_ttl"},
+		},
+		{
+			name:     "disabled only",
+			cols:     nodeColumns{table: true, disabled: true},
+			contains: []string{"false AS dns_hidden", "COALESCE(nodes.dns_disabled, false) AS dns_disabled"},
+			absent:   []string{"nodes.dns_hidden", "nodes.dns_ttl"},
+		},
+		{
+			// Column flags without the table cannot be read
+			name:     "no nodes table",
+			cols:     nodeColumns{hidden: true, disabled: true, ttl: true},
+			contains: []string{"false AS dns_hidden", "false AS dns_disabled", "NULL::bigint AS dns_ttl"},
+			absent:   []string{"JOIN nodes", "nodes."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.cols.query()
+			for _, s := range tt.contains {
+				if !strings.Contains(query, s) {
+					t.Errorf("query lacks %q:\n%s", s, query)
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(query, s) {
+					t.Errorf("query has %q:\n%s", s, query)
+				}
+			}
+		})
+	}
+}
+
+// flagRow is an IPv4 default address row with the node flags set
+func flagRow(node, address string, hidden, disabled bool) []driver.Value {
+	return []driver.Value{node, address, "4", true, hidden, disabled, nil, "{}"}
+}
+
+// served reports whether any record answers for address
+func served(t *testing.T, p *Plugin, address string) bool {
+	t.Helper()
+	records, err := p.LookupReverse(context.Background(), net.ParseIP(address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(records) > 0
+}
+
+func TestSchemaNodeFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		cols  nodeColumns
+		query string
+	}{
+		{name: "both flags", cols: nodeColumns{table: true, hidden: true, disabled: true}, query: "COALESCE(nodes.dns_disabled, false) AS dns_disabled"},
+		{name: "no dns_disabled", cols: nodeColumns{table: true, hidden: true}, query: "false AS dns_disabled"},
+		{name: "no dns_hidden", cols: nodeColumns{table: true, disabled: true}, query: "false AS dns_hidden"},
+		{name: "neither", cols: nodeColumns{table: true}, query: "false AS dns_hidden"},
+		{name: "no nodes table", cols: nodeColumns{}, query: "false AS dns_hidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, mock, _ := newMockPluginWithSchema(t, schemaProbe{addresses: true, nodeColumns: tt.cols})
+			// The database can only report a flag it has a column for
+			rows := sqlmock.NewRows(nodeRecordColumns).
+				AddRow(flagRow("n1", "10.1.0.1", false, false)...).
+				AddRow(flagRow("n2", "10.1.0.2", false, tt.cols.table && tt.cols.disabled)...)
+			mock.ExpectQuery(regexp.QuoteMeta(tt.query)).WillReturnRows(rows)
+
+			if !served(t, p, "10.1.0.1") {
+				t.Error("enabled node not served")
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("query does not match the detected schema: %v", err)
+			}
+			disabled := tt.cols.table && tt.cols.disabled
+			expectNodeRecordsQuery(mock, tt.query, flagRow("n2", "10.1.0.2", false, disabled))
+			if served(t, p, "10.1.0.2") == disabled {
+				t.Errorf("node with dns_disabled=%t served: %t", disabled, !disabled)
+			}
+		})
+	}
+}
+
+// expectNodeRecordsQuery expects one node records query containing query, answered with rows
+func expectNodeRecordsQuery(mock sqlmock.Sqlmock, query string, rows ...[]driver.Value) {
+	result := sqlmock.NewRows(nodeRecordColumns)
+	for _, row := range rows {
+		result.AddRow(row...)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(query)).WillReturnRows(result)
+}
+
+func TestSchemaNodesTableDropped(t *testing.T) {
+	p, mock, _ := newMockPlugin(t)
+	// A migration dropped the nodes table after the schema was detected: the schema is
+	// detected again and node addresses are still served, rather than an empty zone
+	mock.ExpectQuery("LEFT JOIN nodes").WillReturnError(&pq.Error{Code: "42P01"})
+	expectSchemaProbe(mock, schemaProbe{addresses: true})
+	expectNodeRecordsQuery(mock, "false AS dns_hidden", nodeRow("n1", "10.1.0.1"))
+	if !served(t, p, "10.1.0.1") {
+		t.Fatal("node addresses not served once the nodes table was dropped")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSchemaColumnDropped(t *testing.T) {
+	p, mock, _ := newMockPlugin(t)
+	mock.ExpectQuery("nodes.dns_ttl").WillReturnError(&pq.Error{Code: "42703"})
+	expectSchemaProbe(mock, schemaProbe{addresses: true, nodeColumns: nodeColumns{table: true, hidden: true, disabled: true}})
+	expectNodeRecordsQuery(mock, "NULL::bigint AS dns_ttl", nodeRow("n1", "10.1.0.1"))
+	if !served(t, p, "10.1.0.1") {
+		t.Fatal("node addresses not served once nodes.dns_ttl was dropped")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSchemaNodeTablesMissing(t *testing.T) {
+	// DNS-only installs have no node tables at all and serve an empty zone
+	p, mock, _ := newMockPluginWithSchema(t, schemaProbe{})
+	mock.ExpectQuery("FROM nodes").WillReturnError(&pq.Error{Code: "42P01"})
+	expectSchemaProbe(mock, schemaProbe{})
+	if served(t, p, "10.1.0.1") {
+		t.Fatal("records served without node tables")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
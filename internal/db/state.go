@@ -0,0 +1,274 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/lib/pq"
+)
+
+// ConnState is the state of the plugin's database connection
+type ConnState int
+
+const (
+	// StateUnconfigured means no datasource is configured
+	StateUnconfigured ConnState = iota
+	// StateDisconnected means a datasource is configured but no connection was established yet
+	StateDisconnected
+	// StateConnected means the database is reachable
+	StateConnected
+	// StateLost means the database was reachable but stopped answering
+	StateLost
+	// StateClosed means the plugin was closed, no connection will be made again
+	StateClosed
+)
+
+var connStateNames = map[ConnState]string{
+	StateUnconfigured: "unconfigured",
+	StateDisconnected: "disconnected",
+	StateConnected:    "connected",
+	StateLost:         "lost",
+	StateClosed:       "closed",
+}
+
+func (s ConnState) String() string {
+	if name, ok := connStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("ConnState(%d)", int(s))
+}
+
+// connEvent is something that happened to the database connection
+type connEvent int
+
+const (
+	// eventConfigure is fired once a datasource is known
+	eventConfigure connEvent = iota
+	// eventDialSuccess is fired when a connect or ping succeeds
+	eventDialSuccess
+	// eventPingFail is fired when a connect, ping or query fails to reach the database
+	eventPingFail
+	// eventClose is fired when the plugin is closed
+	eventClose
+)
+
+var connEventNames = map[connEvent]string{
+	eventConfigure:   "configure",
+	eventDialSuccess: "dial-success",
+	eventPingFail:    "ping-fail",
+	eventClose:       "close",
+}
+
+func (e connEvent) String() string {
+	if name, ok := connEventNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("connEvent(%d)", int(e))
+}
+
+// connTransitions lists the legal transitions, any other event is rejected
+var connTransitions = map[ConnState]map[connEvent]ConnState{
+	StateUnconfigured: {
+		eventConfigure: StateDisconnected,
+		eventClose:     StateClosed,
+	},
+	StateDisconnected: {
+		eventDialSuccess: StateConnected,
+		eventPingFail:    StateDisconnected,
+		eventClose:       StateClosed,
+	},
+	StateConnected: {
+		eventDialSuccess: StateConnected,
+		eventPingFail:    StateLost,
+		eventClose:       StateClosed,
+	},
+	StateLost: {
+		eventDialSuccess: StateConnected,
+		eventPingFail:    StateLost,
+		eventClose:       StateClosed,
+	},
+	StateClosed: {
+		eventClose: StateClosed,
+	},
+}
+
+// ErrIllegalTransition is returned when an event does not apply to the current state
+var ErrIllegalTransition = errors.New("illegal connection state transition")
+
+// nextConnState returns the state reached from s on ev
+func nextConnState(s ConnState, ev connEvent) (ConnState, error) {
+	next, ok := connTransitions[s][ev]
+	if !ok {
+		return s, fmt.Errorf("%w: %s on %s", ErrIllegalTransition, s, ev)
+	}
+	return next, nil
+}
+
+// fireLocked applies ev to the connection state. p.stateMu must be held.
+func (p *Plugin) fireLocked(ev connEvent) error {
+	next, err := nextConnState(p.state, ev)
+	if err != nil {
+		return err
+	}
+	switch ev {
+	case eventPingFail:
+		// Fail lookups fast while the database is unreachable, and leave finding out when
+		// it is back to a single probe
+		p.failUntil = p.Clock.Now().Add(fastFailWindow)
+		if !p.probing {
+			p.probing = true
+			go p.probe()
+		}
+	case eventDialSuccess:
+		p.failUntil = time.Time{}
+		p.everConnected.Store(true)
+	case eventClose:
+		p.failUntil = time.Time{}
+	}
+	if next != p.state {
+		ilog.Log.Debugf("db: connection %s -> %s (%s)", p.state, next, ev)
+		metrics.DBConnectionState.WithLabelValues(p.state.String()).Set(0)
+		metrics.DBConnectionState.WithLabelValues(next.String()).Set(1)
+		p.state = next
+	}
+	return nil
+}
+
+// fire applies ev to the connection state
+func (p *Plugin) fire(ev connEvent) error {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.fireLocked(ev)
+}
+
+// State returns the current state of the database connection
+func (p *Plugin) State() ConnState {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.state
+}
+
+// HasConnected reports whether the database has answered a ping at least once
+func (p *Plugin) HasConnected() bool {
+	return p.everConnected.Load()
+}
+
+// trackFailure records the start of a run of failed loads, and its end on a success.
+// Loads abandoned by their caller say nothing about the database and are not counted.
+func (p *Plugin) trackFailure(ctx context.Context, err error) {
+	switch {
+	case err == nil:
+		p.failingSince.Store(0)
+	case ctx.Err() == nil:
+		p.failingSince.CompareAndSwap(0, p.Clock.Now().UnixNano())
+	}
+}
+
+// FailingFor returns how long loads have failed without a success in between (0 while
+// they succeed)
+func (p *Plugin) FailingFor() time.Duration {
+	since := p.failingSince.Load()
+	if since == 0 {
+		return 0
+	}
+	return util.Since(p.Clock, time.Unix(0, since))
+}
+
+// conn returns the database to query, dialing or re-pinging it first if needed. Within
+// the fast-fail window no attempt is made, the probe decides when the database is back.
+func (p *Plugin) conn(ctx context.Context) (*sql.DB, error) {
+	p.stateMu.Lock()
+	state, failing := p.state, p.Clock.Now().Before(p.failUntil)
+	p.stateMu.Unlock()
+	if failing {
+		metrics.DBFastFails.Inc()
+		return nil, ErrNotConnected
+	}
+
+	switch state {
+	case StateDisconnected:
+		p.connect(ctx)
+	case StateLost:
+		p.reping(ctx)
+	}
+
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if p.state != StateConnected {
+		return nil, ErrNotConnected
+	}
+	return p.db, nil
+}
+
+// reping checks whether a lost database answers again
+func (p *Plugin) reping(ctx context.Context) {
+	if !p.claimConnectAttempt() {
+		return
+	}
+	p.stateMu.Lock()
+	db := p.db
+	p.stateMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		ilog.Log.Warningf("db: database still unreachable: %v", err)
+		_ = p.fire(eventPingFail)
+		return
+	}
+	if err := p.fire(eventDialSuccess); err == nil {
+		ilog.Log.Infof("db: connection re-established")
+	}
+}
+
+// probe retries the connection in the background until the database answers or the
+// plugin is closed. Failed attempts keep extending the fast-fail window.
+func (p *Plugin) probe() {
+	defer func() {
+		p.stateMu.Lock()
+		p.probing = false
+		p.stateMu.Unlock()
+	}()
+	for {
+		<-p.Clock.After(connectRetryInterval)
+		switch p.State() {
+		case StateDisconnected:
+			p.connect(context.Background())
+		case StateLost:
+			p.reping(context.Background())
+		default:
+			return
+		}
+	}
+}
+
+// queryFailed records a failed query, marking the connection lost when the database
+// could not be reached at all (as opposed to the database rejecting the query)
+func (p *Plugin) queryFailed(ctx context.Context, err error) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) || ctx.Err() != nil {
+		return
+	}
+	_ = p.fire(eventPingFail)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConnStateTransitions(t *testing.T) {
+	const illegal = ConnState(-1)
+	events := []connEvent{eventConfigure, eventDialSuccess, eventPingFail, eventClose}
+	// The expected state reached from each state on each event, in the order of events
+	tests := []struct {
+		from ConnState
+		to   [4]ConnState
+	}{
+		{from: StateUnconfigured, to: [4]ConnState{StateDisconnected, illegal, illegal, StateClosed}},
+		{from: StateDisconnected, to: [4]ConnState{illegal, StateConnected, StateDisconnected, StateClosed}},
+		{from: StateConnected, to: [4]ConnState{illegal, StateConnected, StateLost, StateClosed}},
+		{from: StateLost, to: [4]ConnState{illegal, StateConnected, StateLost, StateClosed}},
+		{from: StateClosed, to: [4]ConnState{illegal, illegal, illegal, StateClosed}},
+	}
+	for _, tt := range tests {
+		for i, ev := range events {
+			t.Run(fmt.Sprintf("%s on %s", tt.from, ev), func(t *testing.T) {
+				clock := util.NewFakeClock(fakeEpoch)
+				p := NewPlugin()
+				p.Clock = clock
+				p.state = tt.from
+				// Keep the reconnect probe from starting, it is covered by TestConnStateProbe
+				p.probing = true
+
+				err := p.fire(ev)
+				expected := tt.to[i]
+				if expected == illegal {
+					if !errors.Is(err, ErrIllegalTransition) {
+						t.Fatalf("expected ErrIllegalTransition, got %v", err)
+					}
+					if p.State() != tt.from {
+						t.Fatalf("refused event moved the state to %s", p.State())
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.State() != expected {
+					t.Fatalf("reached %s, expected %s", p.State(), expected)
+				}
+				if expected != tt.from {
+					from := testutil.ToFloat64(metrics.DBConnectionState.WithLabelValues(tt.from.String()))
+					to := testutil.ToFloat64(metrics.DBConnectionState.WithLabelValues(expected.String()))
+					if from != 0 || to != 1 {
+						t.Errorf("state gauges are %v for %s and %v for %s", from, tt.from, to, expected)
+					}
+				}
+
+				// Side effects of the event, measured against the fake clock
+				switch ev {
+				case eventPingFail:
+					if !p.failUntil.Equal(fakeEpoch.Add(fastFailWindow)) {
+						t.Errorf("fast-fail window ends at %s, expected %s", p.failUntil, fakeEpoch.Add(fastFailWindow))
+					}
+				case eventDialSuccess, eventClose:
+					if !p.failUntil.IsZero() {
+						t.Errorf("fast-fail window not cleared")
+					}
+				}
+				if ev == eventDialSuccess && !p.HasConnected() {
+					t.Error("successful dial not recorded")
+				}
+			})
+		}
+	}
+}
+
+func TestConnStateTransitionTableComplete(t *testing.T) {
+	// Every state has an entry, even if only to be closed
+	for state := range connStateNames {
+		if _, ok := connTransitions[state]; !ok {
+			t.Errorf("no transitions from %s", state)
+		}
+	}
+}
+
+func TestConnStateProbe(t *testing.T) {
+	clock := util.NewFakeClock(fakeEpoch)
+	p := NewPlugin()
+	p.Clock = clock
+	p.state = StateConnected
+
+	if err := p.fire(eventPingFail); err != nil {
+		t.Fatal(err)
+	}
+	// Failures within the window don't start another probe
+	if err := p.fire(eventPingFail); err != nil {
+		t.Fatal(err)
+	}
+	clock.BlockUntil(1)
+	time.Sleep(5 * time.Millisecond)
+	if n := clock.Waiters(); n != 1 {
+		t.Fatalf("%d probes waiting, expected 1", n)
+	}
+
+	// The window slides with the clock, and the probe stops once the plugin is closed
+	clock.Advance(fastFailWindow / 2)
+	if err := p.fire(eventPingFail); err != nil {
+		t.Fatal(err)
+	}
+	if !p.failUntil.Equal(clock.Now().Add(fastFailWindow)) {
+		t.Errorf("fast-fail window not extended")
+	}
+	if err := p.fire(eventClose); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(connectRetryInterval)
+	for {
+		p.stateMu.Lock()
+		probing := p.probing
+		p.stateMu.Unlock()
+		if !probing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if p.State() != StateClosed {
+		t.Fatalf("probe left the closed plugin in %s", p.State())
+	}
+}
@@ -0,0 +1,277 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package metrics
+
+import (
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/version"
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// BuildInfo is always 1, labelled with the plugin build.
+	BuildInfo = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   plugin.Namespace,
+		Subsystem:   log.PluginName,
+		Name:        "build_info",
+		Help:        "A metric with a constant '1' value labelled by the plugin version and commit.",
+		ConstLabels: prometheus.Labels{"version": version.Version, "commit": version.Commit},
+	}, func() float64 { return 1 })
+	// Requests counts the queries handled by the plugin by type and result, e.g. answer,
+	// nodata, nxdomain, fallthrough, not-in-zone or error.
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "requests_total",
+		Help:      "Counter of queries handled by query type and result.",
+	}, []string{"type", "result"})
+	// PinnedAnswers counts queries answered from records pinned in the Corefile, by name.
+	PinnedAnswers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "pinned_answers_total",
+		Help:      "Counter of queries answered from pinned records by name.",
+	}, []string{"name"})
+	// NegativeCacheHits counts queries answered NXDOMAIN from the negative cache.
+	NegativeCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "negative_cache_hits_total",
+		Help:      "Counter of queries answered from the negative cache.",
+	}, []string{"zone"})
+	// CacheEvictions counts entries evicted from the plugin's caches, by cache and reason.
+	CacheEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "cache_evictions_total",
+		Help:      "Counter of cache entries evicted because the cache was full or the entry expired.",
+	}, []string{"cache", "reason"})
+	// RequestsAborted counts requests dropped because the client context was already done.
+	RequestsAborted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "requests_aborted_total",
+		Help:      "Counter of requests abandoned because their context was done.",
+	}, []string{"stage"})
+	// BadQuestionCount counts queries whose question section does not hold exactly one question.
+	BadQuestionCount = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "bad_question_count_total",
+		Help:      "Counter of queries with a question count other than one.",
+	})
+	// ManagementRejected counts rejected updates and zone transfers, by reason.
+	ManagementRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "management_rejected_total",
+		Help:      "Counter of rejected dynamic updates and zone transfers.",
+	}, []string{"reason"})
+	// ShedTransitions counts entries into and exits from load shedding mode.
+	ShedTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "shed_transitions_total",
+		Help:      "Counter of load shedding mode entries and exits.",
+	}, []string{"transition"})
+	// ShedDropped counts lookups rejected while shedding load.
+	ShedDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "shed_dropped_total",
+		Help:      "Counter of lookups rejected while shedding load.",
+	})
+	// SchedulerJobDuration is the duration of scheduled background job runs.
+	SchedulerJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "scheduler_job_duration_seconds",
+		Buckets:   plugin.TimeBuckets,
+		Help:      "Histogram of the time scheduled background jobs took.",
+	}, []string{"job"})
+	// SchedulerLastRun is the Unix time of the last run of each scheduled job.
+	SchedulerLastRun = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "scheduler_job_last_run_timestamp_seconds",
+		Help:      "Unix time of the last run of each scheduled background job.",
+	}, []string{"job"})
+	// SchedulerLastError is 1 when the last run of a scheduled job failed, 0 otherwise.
+	SchedulerLastError = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "scheduler_job_last_error",
+		Help:      "Whether the last run of each scheduled background job failed (1) or not (0).",
+	}, []string{"job"})
+	// RecordChanges counts records added, removed, or changed between refreshes.
+	RecordChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "record_changes_total",
+		Help:      "Counter of record changes observed between refreshes.",
+	}, []string{"source", "change"})
+	// NameCollisions counts names produced by more than one owner during a load.
+	NameCollisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "name_collisions_total",
+		Help:      "Counter of names produced by more than one node.",
+	}, []string{"source"})
+	// InvalidNames counts names skipped during a load for exceeding DNS name limits.
+	InvalidNames = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "invalid_names_total",
+		Help:      "Counter of record names skipped for not being valid domain names.",
+	}, []string{"source"})
+	// ExcludedAddresses counts address records within excluded prefixes during a load, by
+	// what was done with them.
+	ExcludedAddresses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "excluded_addresses_total",
+		Help:      "Counter of address records within excluded prefixes, dropped or substituted.",
+	}, []string{"source", "action"})
+	// CNAMEConflicts counts owners with a CNAME and other records during a load.
+	CNAMEConflicts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "cname_conflicts_total",
+		Help:      "Counter of names with a CNAME and other records.",
+	}, []string{"source"})
+	// DBQueriesInFlight is the number of database queries currently running.
+	DBQueriesInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "db_queries_in_flight",
+		Help:      "Number of database queries currently running.",
+	})
+	// BootstrapHandoff is 1 once the dynamic zone has taken over from the bootstrap zone.
+	BootstrapHandoff = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "bootstrap_handoff",
+		Help:      "Whether the dynamic zone has taken over from the bootstrap zone (1) or not (0).",
+	})
+	// DBConnectionState is 1 for the current state of the database connection, 0 otherwise.
+	DBConnectionState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "db_connection_state",
+		Help:      "Current state of the database connection (1 for the current state).",
+	}, []string{"state"})
+	// DBQueryDuration is the duration of database queries, including reading the rows.
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "db_query_duration_seconds",
+		Buckets:   plugin.TimeBuckets,
+		Help:      "Histogram of the time database queries took.",
+	}, []string{"query"})
+	// SlowQueries counts database queries slower than the slow_query_log threshold.
+	SlowQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "slow_queries_total",
+		Help:      "Counter of database queries slower than the slow query threshold.",
+	}, []string{"query"})
+	// DBRetries counts retries of loads that failed with a transient error, by outcome.
+	DBRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "db_retries_total",
+		Help:      "Counter of retried loads after transient database errors, by outcome.",
+	}, []string{"outcome"})
+	// DBFastFails counts lookups failed without a query during a database outage.
+	DBFastFails = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "db_fast_fails_total",
+		Help:      "Counter of lookups failed fast while the database is unreachable.",
+	})
+	// DBQueryTimeouts counts records queries that ran out of the query timeout.
+	DBQueryTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "db_query_timeouts_total",
+		Help:      "Counter of node records queries that exceeded the query timeout.",
+	})
+	// DBSchemaMode is 1 for the database schema the node records are read with, 0 otherwise.
+	DBSchemaMode = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "db_schema_mode",
+		Help:      "Database schema used to read node records (1 for the one in use).",
+	}, []string{"mode"})
+	// DBSchemaMissing is 1 while the node tables are missing from the database.
+	DBSchemaMissing = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "db_schema_missing",
+		Help:      "Whether the node tables are missing from the database (1) or not (0).",
+	})
+	// MaintenanceMode is 1 while the plugin is in maintenance mode, 0 otherwise.
+	MaintenanceMode = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "maintenance_mode",
+		Help:      "Whether the plugin is in maintenance mode (1) or not (0).",
+	})
+	// AddressHealthy is 1 while a probed address is considered reachable, 0 otherwise.
+	AddressHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "address_healthy",
+		Help:      "Whether a probed address is considered reachable (1) or not (0).",
+	}, []string{"address"})
+	// WebhookDeliveries counts record change webhook deliveries by result.
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "webhook_deliveries_total",
+		Help:      "Counter of record change webhook deliveries by result (success, failure, dropped).",
+	}, []string{"result"})
+	// SnapshotGeneration is the generation of the record set currently served by each source.
+	SnapshotGeneration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "snapshot_generation",
+		Help:      "Generation of the record set currently served by source.",
+	}, []string{"source"})
+	// RecordSetRecords is the number of records held in memory by each source.
+	RecordSetRecords = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "record_set_records",
+		Help:      "Number of records held in memory by source.",
+	}, []string{"source"})
+	// Records is the number of records loaded by each source, by record type.
+	Records = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "records",
+		Help:      "Number of records loaded by source and type.",
+	}, []string{"source", "type"})
+	// RecordSetBytes is the approximate memory held by each source's records.
+	RecordSetBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: log.PluginName,
+		Name:      "record_set_bytes",
+		Help:      "Approximate bytes held in memory by source.",
+	}, []string{"source"})
+)
@@ -0,0 +1,122 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// SOA timers in seconds. No secondaries transfer these zones, so they only matter to tools.
+const (
+	soaRefresh = 3600
+	soaRetry   = 600
+	soaExpire  = 86400
+)
+
+// Default SOA names, overridden with the soa option
+var (
+	defaultSOAMname = "ns." + util.ZoneDynamic
+	defaultSOARname = "hostmaster." + util.ZoneDynamic
+)
+
+// zoneTTL returns the TTL of records served in zone
+func (p *PcePlugin) zoneTTL(zone string) uint32 {
+	if zone == util.ZoneBootstrap {
+		return p.static.TTL
+	}
+	return p.db.TTL
+}
+
+// soaRecord returns the SOA of zone. Unless a serial is configured, the serial is the time
+// the zone's record set last changed, so it increases with every change.
+func (p *PcePlugin) soaRecord(zone string) util.Record {
+	serial := p.soaSerial
+	if serial == 0 {
+		serial = p.zoneSerial(zone)
+	}
+	ttl := p.zoneTTL(zone)
+	return util.Record{
+		FQDN: zone,
+		Type: dns.TypeSOA,
+		TTL:  ttl,
+		Content: util.RecordContent{SOA: &util.SOAContent{
+			Mname:   p.soaMname,
+			Rname:   p.soaRname,
+			Serial:  serial,
+			Refresh: soaRefresh,
+			Retry:   soaRetry,
+			Expire:  soaExpire,
+			// Names appear as soon as they are loaded, so don't cache their absence for longer
+			// than their records
+			Minttl: ttl,
+		}},
+	}
+}
+
+// zoneSerial derives the SOA serial from when the zone's source last loaded changes
+func (p *PcePlugin) zoneSerial(zone string) uint32 {
+	var at time.Time
+	if zone == util.ZoneBootstrap {
+		at = p.static.SnapshotAt()
+	} else {
+		at = p.db.SnapshotAt()
+	}
+	if at.IsZero() {
+		return 1
+	}
+	return uint32(at.Unix())
+}
+
+// soaAuthority returns the authority section of negative answers in zone (RFC 2308)
+func (p *PcePlugin) soaAuthority(zone string) []dns.RR {
+	soa := p.soaRecord(zone)
+	rr, err := soa.AsSOARecord()
+	if err != nil {
+		log.Log.Errorf("failed to build SOA for zone %q: %v", zone, err)
+		return nil
+	}
+	return []dns.RR{rr}
+}
+
+// apexRecords returns the SOA, NS and configured TXT records at the apex of zone answering
+// name and qtype, and whether name is the apex
+func (p *PcePlugin) apexRecords(zone, name string, qtype uint16) ([]util.Record, bool) {
+	if name != zone {
+		return nil, false
+	}
+
+	texts := p.apexTXT[zone]
+	records := make([]util.Record, 0, len(texts)+2)
+	records = append(records, p.soaRecord(zone), util.Record{
+		FQDN:    zone,
+		Type:    dns.TypeNS,
+		TTL:     p.zoneTTL(zone),
+		Content: util.RecordContent{Target: p.soaMname},
+	})
+	for _, text := range texts {
+		records = append(records, util.Record{
+			FQDN:    zone,
+			Type:    dns.TypeTXT,
+			TTL:     p.zoneTTL(zone),
+			Content: util.RecordContent{Data: text},
+		})
+	}
+	return util.MatchRecords(records, name, qtype)
+}
@@ -17,6 +17,10 @@ package pce
 
 import (
 	"errors"
+	"net"
+	"slices"
+	"sync/atomic"
+	"time"
 
 	"github.com/PextraCloud/pce-coredns/internal/db"
 	"github.com/PextraCloud/pce-coredns/internal/log"
@@ -25,6 +29,16 @@ import (
 	"github.com/coredns/coredns/plugin"
 )
 
+// Modes select the sources the plugin serves from
+const (
+	// modeDB serves the dynamic zone from the database and the bootstrap zone from the static file
+	modeDB = "db"
+	// modeStatic serves only the bootstrap zone, the database is never opened
+	modeStatic = "static"
+	// modeOff serves nothing and passes every query on
+	modeOff = "off"
+)
+
 type PcePlugin struct {
 	// Next is the next plugin in the chain
 	Next plugin.Handler
@@ -33,6 +47,101 @@ type PcePlugin struct {
 	db *db.Plugin
 	// static plugin serves from a static PCE config
 	static *static.Plugin
+
+	// mode is one of modeDB, modeStatic or modeOff
+	mode string
+	// servedZones restricts the zones served to some of the available ones (nil for all)
+	servedZones []string
+	// zoneMatcher matches query names against availableZones()
+	zoneMatcher *util.ZoneMatcher
+	// clock is the source of time of this instance and its adapters
+	clock util.Clock
+	// scheduler runs the periodic background jobs of this instance
+	scheduler *util.Scheduler
+
+	// snapshotPath is where the record sets are snapshotted for disaster recovery ("" for none)
+	snapshotPath string
+	// snapshotMaxAge is the age above which a snapshot is not loaded
+	snapshotMaxAge time.Duration
+	// snapshotWritten holds the generation of each source in the last written snapshot
+	snapshotWritten map[string]uint64
+
+	// negCache remembers names that recently resolved to NXDOMAIN
+	negCache *util.LRU[negativeCacheKey, uint64]
+	// debugACL lists the networks allowed to send `_debug.` queries (nil disables them)
+	debugACL []*net.IPNet
+	// traceDecisions logs the decisions taken for each query
+	traceDecisions bool
+	// traceNames limits decision tracing to queries under these names (all if empty)
+	traceNames []string
+	// chaosVersion answers CHAOS TXT version.bind. and version.pce. with the plugin build
+	chaosVersion bool
+	// debugSnapshot attaches the record set snapshot to answers as an EDE
+	debugSnapshot bool
+	// overrideACL lists the networks allowed to bypass answer shaping (nil disables the override)
+	overrideACL []*net.IPNet
+	// overrideCode is the EDNS0 local option code requesting the override
+	overrideCode uint16
+
+	// handoff moves bootstrap names to the dynamic zone once the db is healthy (nil disables it)
+	handoff *bootstrapHandoff
+	// bootstrapCNAMERole points bootstrap node names at the node's name for this role once
+	// the node is in the dynamic zone ("" disables it)
+	bootstrapCNAMERole string
+	// soaMname and soaRname are the name server and mailbox of the zones' SOA, soaMname
+	// also being their NS
+	soaMname string
+	soaRname string
+	// soaSerial is the fixed SOA serial (0 derives it from the record sets)
+	soaSerial uint32
+	// reverse lists the prefixes whose addresses are answered in the reverse zones
+	reverse []*net.IPNet
+	// reverseZones are the reverse zones enclosing the reverse prefixes
+	reverseZones []string
+	// exclusion keeps addresses within excluded prefixes out of both sources (nil for none)
+	exclusion *util.AddressExclusion
+	// pins maps names to the records pinned for them in the Corefile, which are answered
+	// instead of any source
+	pins map[string][]util.Record
+	// apexTXT maps zones to the TXT strings served at their apex
+	apexTXT map[string][]string
+	// filters post-process looked up records before they are answered
+	filters []FilterFunc
+	// prober filters addresses failing health probes out of answers (nil disables it)
+	prober *healthProber
+	// webhook posts record changes to an external endpoint (nil disables it)
+	webhook *webhookSender
+	// unhealthyAfter is how long database loads may fail before Health reports false (0
+	// for never)
+	unhealthyAfter time.Duration
+	// maintenance serves the last known records while its file exists (nil disables it)
+	maintenance *maintenanceMode
+	// shed rejects database lookups under sustained overload (nil disables it)
+	shed *shedder
+	// compress enables name compression in responses
+	compress bool
+	// rewrites map legacy query names onto served names before lookup
+	rewrites []nameRewrite
+	// startupChecks are looked up once setup completes
+	startupChecks []startupCheck
+	// startupChecksStrict fails setup when a startup check returns no records
+	startupChecksStrict bool
+	// notImpObsolete answers NOTIMP for obsolete query types instead of looking them up
+	notImpObsolete bool
+	// firstQuestionOnly answers the first question of multi-question queries instead of FORMERR
+	firstQuestionOnly bool
+
+	// config is the live runtime config, swapped when configFile changes
+	config atomic.Pointer[runtimeConfig]
+	// baseConfig is the runtime config from the Corefile, which configFile is applied over
+	baseConfig runtimeConfig
+	// configFile is the optional path of the runtime config file
+	configFile string
+	// configSize and configMtime are the size and modification time of the last read configFile (change detection)
+	configSize  int64
+	configMtime time.Time
+	// rotation counts shaped answers, selecting the round robin rotation of each
+	rotation atomic.Uint64
 }
 
 // comp-time check: PcePlugin implements plugin.Handler
@@ -40,9 +149,38 @@ var _ plugin.Handler = (*PcePlugin)(nil)
 
 func (p *PcePlugin) Name() string { return log.PluginName }
 
-// zones returns the zones that this plugin is authoritative for
+// zones returns the zones that this plugin is authoritative for: the available zones, or
+// those of them listed by the zones directive
 func (p *PcePlugin) zones() []string {
-	return util.ZonesList
+	zones := p.availableZones()
+	if p.servedZones == nil {
+		return zones
+	}
+	return slices.DeleteFunc(zones, func(zone string) bool {
+		return !slices.Contains(p.servedZones, zone)
+	})
+}
+
+// availableZones returns the zones that the sources of the mode can serve
+func (p *PcePlugin) availableZones() []string {
+	switch p.mode {
+	case modeStatic:
+		return append([]string{util.ZoneBootstrap}, p.reverseZones...)
+	case modeOff:
+		return nil
+	default:
+		return append(slices.Clone(util.ZonesList), p.reverseZones...)
+	}
+}
+
+// matchZone returns the most specific zone containing name ("" for none). Names in an
+// available zone that is not served are not ours, even within a served parent zone.
+func (p *PcePlugin) matchZone(name string) string {
+	zone, _ := p.zoneMatcher.MatchZone(name)
+	if p.servedZones != nil && !slices.Contains(p.servedZones, zone) {
+		return ""
+	}
+	return zone
 }
 
 func (p *PcePlugin) adapterFromZone(zone string) (util.Adapter, error) {
@@ -50,8 +188,38 @@ func (p *PcePlugin) adapterFromZone(zone string) (util.Adapter, error) {
 	case util.ZoneDynamic:
 		return p.db, nil
 	case util.ZoneBootstrap:
+		if p.handoff != nil || p.bootstrapCNAMERole != "" {
+			return &bootstrapAdapter{Plugin: p.static, db: p.db, handoff: p.handoff, cnameRole: p.bootstrapCNAMERole}, nil
+		}
 		return p.static, nil
 	default:
+		if isReverseZone(zone) {
+			return &reverseAdapter{sources: p.reverseSources()}, nil
+		}
 		return nil, errors.New("unknown zone: " + zone)
 	}
 }
+
+// sourceFromZone names the record source backing a zone
+func sourceFromZone(zone string) string {
+	switch zone {
+	case util.ZoneDynamic:
+		return util.SourceDB
+	case util.ZoneBootstrap:
+		return util.SourceStatic
+	default:
+		if isReverseZone(zone) {
+			return sourceReverse
+		}
+		return "unknown"
+	}
+}
+
+// attributeRecords sets the source of records whose adapter did not
+func attributeRecords(records []util.Record, zone string) {
+	for i := range records {
+		if records[i].Source == "" {
+			records[i].Source = sourceFromZone(zone)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"strings"
+
+	"github.com/PextraCloud/pce-coredns/internal/db"
+	"github.com/PextraCloud/pce-coredns/internal/static"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// bootstrapAdapter serves the bootstrap zone from static records, switching names that
+// have moved to the dynamic zone to a CNAME into it. Whenever the dynamic zone cannot
+// answer for the target, the static records are served as before.
+type bootstrapAdapter struct {
+	*static.Plugin
+	db *db.Plugin
+	// handoff maps <nodeId>.bootstrap.pce.internal. to the node's name for its cname role
+	// once the handoff happened (nil or without a cname role disables it)
+	handoff *bootstrapHandoff
+	// cnameRole maps <nodeId>.bootstrap.pce.internal. to the node's name for this role
+	// in the dynamic zone ("" disables it)
+	cnameRole string
+}
+
+// cnameTarget returns the dynamic zone name a bootstrap name should point to: the name of
+// the node's role, from bootstrap_cname at once or from the handoff once it happened
+func (a *bootstrapAdapter) cnameTarget(name string) (string, bool) {
+	role := a.cnameRole
+	if role == "" && a.handoff != nil && a.handoff.done.Load() {
+		role = a.handoff.cnameRole
+	}
+	if role == "" {
+		return "", false
+	}
+	nodeId := strings.TrimSuffix(name, "."+util.ZoneBootstrap)
+	if nodeId == name || strings.Contains(nodeId, ".") {
+		return "", false
+	}
+	return a.db.NodeFQDN(nodeId, role)
+}
+
+func (a *bootstrapAdapter) LookupRecords(ctx context.Context, name string, qtype uint16) ([]util.Record, bool, error) {
+	target, ok := a.cnameTarget(name)
+	if !ok {
+		return a.Plugin.LookupRecords(ctx, name, qtype)
+	}
+	targetRecords, exists, err := a.db.LookupRecords(ctx, target, qtype)
+	if err != nil || !exists {
+		// The bootstrap records still answer for names the dynamic zone does not have
+		return a.Plugin.LookupRecords(ctx, name, qtype)
+	}
+
+	cname := util.Record{
+		FQDN:    name,
+		Type:    dns.TypeCNAME,
+		TTL:     a.db.TTL,
+		Content: util.RecordContent{CNAME: target},
+		Source:  util.SourceDB,
+	}
+	if qtype == dns.TypeCNAME {
+		return []util.Record{cname}, true, nil
+	}
+	// Include the target records so clients need no second query
+	return append([]util.Record{cname}, targetRecords...), true, nil
+}
+
+// Generation changes whenever either record set changes, since both feed the answers
+func (a *bootstrapAdapter) Generation() uint64 {
+	return a.Plugin.Generation() + a.db.Generation()
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/caddy"
+	"github.com/miekg/dns"
+)
+
+func TestHandoffCNAME(t *testing.T) {
+	d, mock := newMockDB(t)
+	d.CacheTTL = time.Minute
+	p := newChaseTestPlugin(t, `{"nodes":{"n1":"10.0.0.1","n2":"10.0.0.2"}}`, nil)
+	p.db = d
+	p.handoff = &bootstrapHandoff{probes: 1, cnameRole: util.RoleManagement}
+
+	// Before the handoff the bootstrap records answer
+	m := query(t, p, "n1.bootstrap.pce.internal.")
+	if ips := addresses(m.Answer); len(ips) != 1 || ips[0] != "10.0.0.1" || m.Answer[0].Header().Rrtype != dns.TypeA {
+		t.Fatalf("expected the bootstrap address before the handoff, got %v", m.Answer)
+	}
+
+	// n1 is in the dynamic zone, n2 is not. The probe queries the database directly, the
+	// lookups load the cache.
+	n1 := []driver.Value{"n1", "10.1.0.1", "4", true, false, false, nil, "{management}"}
+	expectNodeRecords(mock, n1)
+	if healthy := p.handoff.probe(d, 0); healthy != 1 || !p.handoff.done.Load() {
+		t.Fatalf("handoff did not happen after a healthy probe")
+	}
+	expectNodeRecords(mock, n1)
+
+	m = query(t, p, "n1.bootstrap.pce.internal.")
+	if len(m.Answer) != 2 {
+		t.Fatalf("expected CNAME and A, got %v", m.Answer)
+	}
+	cname, ok := m.Answer[0].(*dns.CNAME)
+	if !ok || cname.Target != "n1-management.pce.internal." {
+		t.Fatalf("expected a CNAME to n1-management.pce.internal., got %v", m.Answer[0])
+	}
+	if a, ok := m.Answer[1].(*dns.A); !ok || a.A.String() != "10.1.0.1" {
+		t.Fatalf("expected the dynamic address, got %v", m.Answer[1])
+	}
+
+	// Names the dynamic zone does not have keep their bootstrap records
+	m = query(t, p, "n2.bootstrap.pce.internal.")
+	if ips := addresses(m.Answer); len(ips) != 1 || ips[0] != "10.0.0.2" || len(m.Answer) != 1 {
+		t.Fatalf("expected the bootstrap address of n2, got %v", m.Answer)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetupHandoffCNAMERole(t *testing.T) {
+	tests := []struct {
+		args   string
+		probes int
+		role   string
+		wantOK bool
+	}{
+		{args: "auto", probes: defaultHandoffProbes, wantOK: true},
+		{args: "auto 5", probes: 5, wantOK: true},
+		{args: "auto cname", probes: defaultHandoffProbes, role: util.RoleClusterInternal, wantOK: true},
+		{args: "auto cname management", probes: defaultHandoffProbes, role: util.RoleManagement, wantOK: true},
+		{args: "auto cname management 5", probes: 5, role: util.RoleManagement, wantOK: true},
+		{args: "auto 5 cname replication", probes: 5, role: util.RoleReplication, wantOK: true},
+		{args: "auto cname storage", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			c := caddy.NewTestController("dns", "pce {\n datasource host=/nonexistent\n bootstrap_handoff "+tt.args+"\n}")
+			p, err := parseConfig(c)
+			if ok := err == nil; ok != tt.wantOK {
+				t.Fatalf("expected ok=%t, got error %v", tt.wantOK, err)
+			}
+			if p == nil {
+				return
+			}
+			_ = p.static.Close()
+			_ = p.db.Close()
+			p.scheduler.Stop()
+			if p.handoff.probes != tt.probes || p.handoff.cnameRole != tt.role {
+				t.Fatalf("got %d probes and role %q, expected %d and %q", p.handoff.probes, p.handoff.cnameRole, tt.probes, tt.role)
+			}
+		})
+	}
+}
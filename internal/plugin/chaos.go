@@ -0,0 +1,54 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/version"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// versionNames are the CHAOS TXT names answered with the plugin build
+var versionNames = map[string]struct{}{
+	"version.bind.": {},
+	"version.pce.":  {},
+}
+
+// isVersionQuery reports whether the query asks for the plugin build
+func (p *PcePlugin) isVersionQuery(state request.Request) bool {
+	if !p.chaosVersion || state.QClass() != dns.ClassCHAOS {
+		return false
+	}
+	if qtype := state.QType(); qtype != dns.TypeTXT && qtype != dns.TypeANY {
+		return false
+	}
+	_, ok := versionNames[state.Name()]
+	return ok
+}
+
+// serveVersion answers the CHAOS version query with the plugin build
+func (p *PcePlugin) serveVersion(state request.Request) (int, error) {
+	log.Log.Debugf("answering version query from %s", state.IP())
+	txt := &dns.TXT{
+		Hdr: dns.RR_Header{Name: state.QName(), Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+		Txt: []string{log.PluginName + " " + version.String()},
+	}
+	// Synthesized, so the AA bit is left unset
+	resp := &response{rcode: dns.RcodeSuccess, answer: []dns.RR{txt}, compress: p.compress}
+	resp.write(state)
+	return dns.RcodeSuccess, nil
+}
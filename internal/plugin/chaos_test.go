@@ -0,0 +1,44 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestVersionQueryNotAuthoritative(t *testing.T) {
+	p := newChaseTestPlugin(t, `{}`, nil)
+	p.chaosVersion = true
+
+	req := new(dns.Msg)
+	req.SetQuestion("version.bind.", dns.TypeTXT)
+	req.Question[0].Qclass = dns.ClassCHAOS
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := p.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Msg.Answer) != 1 || rec.Msg.Answer[0].Header().Class != dns.ClassCHAOS {
+		t.Fatalf("expected one CHAOS TXT record, got %v", rec.Msg.Answer)
+	}
+	if rec.Msg.Authoritative {
+		t.Fatal("version reply has the AA bit set")
+	}
+}
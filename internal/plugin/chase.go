@@ -0,0 +1,99 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain is the most CNAMEs followed for a single answer
+const maxCNAMEChain = 8
+
+// chaseCNAMEs follows the CNAME answering an address query to its target when the target
+// is in a served zone, appending the records found there, so clients get the addresses in
+// the same response. Chains are followed up to maxCNAMEChain hops and never revisit a name.
+// Targets the adapter already answered for are not looked up again, so adapters including
+// their CNAME targets own those records.
+// Chasing is best effort: if a lookup fails the chain ends, and the client follows the
+// last CNAME itself.
+func (p *PcePlugin) chaseCNAMEs(ctx context.Context, records []util.Record, qtype uint16) []util.Record {
+	if qtype != dns.TypeA && qtype != dns.TypeAAAA {
+		return records
+	}
+	visited := map[string]struct{}{}
+	last := records
+	for range maxCNAMEChain {
+		owner, target := cnameTarget(last)
+		if target == "" {
+			return records
+		}
+		visited[owner] = struct{}{}
+		if _, loop := visited[target]; loop {
+			log.Log.Debugf("CNAME loop at %q, not following further", target)
+			return records
+		}
+		visited[target] = struct{}{}
+		if hasOwner(records, target) {
+			// The adapter already answered with the target records, e.g. the bootstrap
+			// adapter's CNAMEs into the dynamic zone
+			return records
+		}
+
+		zone := p.matchZone(target)
+		if zone == "" {
+			// Out of zone, the client resolves it elsewhere
+			return records
+		}
+		adapter, err := p.adapterFromZone(zone)
+		if err != nil {
+			return records
+		}
+		found, _, err := adapter.LookupRecords(ctx, target, qtype)
+		if err != nil {
+			log.Log.Debugf("CNAME target lookup failed for %q: %v", target, err)
+			return records
+		}
+		attributeRecords(found, zone)
+		records = append(records, found...)
+		last = found
+	}
+	log.Log.Debugf("CNAME chain longer than %d, not following further", maxCNAMEChain)
+	return records
+}
+
+// hasOwner reports whether any of records is owned by name
+func hasOwner(records []util.Record, name string) bool {
+	for _, record := range records {
+		if record.FQDN == name {
+			return true
+		}
+	}
+	return false
+}
+
+// cnameTarget returns the owner and target of the CNAME in records ("" for none)
+func cnameTarget(records []util.Record) (string, string) {
+	for _, record := range records {
+		if record.Type == dns.TypeCNAME {
+			return record.FQDN, dns.CanonicalName(record.Content.CNAME)
+		}
+	}
+	return "", ""
+}
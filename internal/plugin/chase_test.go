@@ -0,0 +1,127 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PextraCloud/pce-coredns/internal/db"
+	"github.com/PextraCloud/pce-coredns/internal/static"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+// newChaseTestPlugin serves the static file content from the bootstrap zone and dbRecords
+// from the dynamic zone
+func newChaseTestPlugin(t *testing.T, content string, dbRecords []util.Record) *PcePlugin {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "static.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := static.NewPlugin()
+	s.Path = path
+	s.Interval = 0
+	s.AliasCNAME = true
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	// Without a datasource the seeded records are served
+	d := db.NewPlugin()
+	d.Seed(dbRecords)
+
+	p := &PcePlugin{db: d, static: s, mode: modeDB, clock: util.RealClock, compress: true}
+	p.config.Store(&runtimeConfig{})
+	p.zoneMatcher = util.NewZoneMatcher(p.availableZones())
+	return p
+}
+
+func addressRecord(name, ip string) util.Record {
+	return util.Record{FQDN: name, Type: dns.TypeA, TTL: 30, Content: util.RecordContent{IP: net.ParseIP(ip)}}
+}
+
+func query(t *testing.T, p *PcePlugin, name string) *dns.Msg {
+	t.Helper()
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := p.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Msg
+}
+
+func TestChaseSingleHop(t *testing.T) {
+	p := newChaseTestPlugin(t, `{"nodes":{"n1":"10.0.0.1"},"aliases":{"a":"n1"}}`, nil)
+	m := query(t, p, "a.bootstrap.pce.internal.")
+	if len(m.Answer) != 2 {
+		t.Fatalf("expected CNAME and A, got %v", m.Answer)
+	}
+	if m.Answer[0].Header().Rrtype != dns.TypeCNAME || m.Answer[1].(*dns.A).A.String() != "10.0.0.1" {
+		t.Fatalf("unexpected answer %v", m.Answer)
+	}
+}
+
+func TestChaseOutOfZone(t *testing.T) {
+	p := newChaseTestPlugin(t, `{}`, nil)
+	records := []util.Record{{FQDN: "a.bootstrap.pce.internal.", Type: dns.TypeCNAME, Content: util.RecordContent{CNAME: "example.com."}}}
+	if chased := p.chaseCNAMEs(context.Background(), records, dns.TypeA); len(chased) != 1 {
+		t.Fatalf("out of zone target was chased: %v", chased)
+	}
+}
+
+func TestChaseLoop(t *testing.T) {
+	p := newChaseTestPlugin(t, `{}`, []util.Record{
+		{FQDN: "b.pce.internal.", Type: dns.TypeCNAME, TTL: 30, Content: util.RecordContent{CNAME: "a.pce.internal."}},
+	})
+	records := []util.Record{{FQDN: "a.pce.internal.", Type: dns.TypeCNAME, Content: util.RecordContent{CNAME: "b.pce.internal."}}}
+	chased := p.chaseCNAMEs(context.Background(), records, dns.TypeA)
+	if len(chased) != 2 {
+		t.Fatalf("expected the loop to stop after one hop, got %v", chased)
+	}
+}
+
+func TestChaseBootstrapCNAME(t *testing.T) {
+	p := newChaseTestPlugin(t, `{"nodes":{"n1":"10.0.0.1"}}`, []util.Record{
+		addressRecord("n1-management.pce.internal.", "10.1.0.1"),
+		addressRecord("n1-management.pce.internal.", "10.1.0.2"),
+	})
+	p.bootstrapCNAMERole = util.RoleManagement
+
+	m := query(t, p, "n1.bootstrap.pce.internal.")
+	if len(m.Answer) != 3 {
+		t.Fatalf("expected the CNAME and each address once, got %v", m.Answer)
+	}
+	seen := map[string]bool{}
+	for _, rr := range m.Answer[1:] {
+		a, ok := rr.(*dns.A)
+		if !ok {
+			t.Fatalf("unexpected record %v", rr)
+		}
+		if seen[a.A.String()] {
+			t.Fatalf("address %s answered twice", a.A)
+		}
+		seen[a.A.String()] = true
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/db"
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// debugPrefix marks a query asking for a description of the records behind a name
+const debugPrefix = "_debug."
+
+// debugTTL is kept at 0 so debug answers are never cached downstream
+const debugTTL = 0
+
+// localhostNetworks is the default ACL for debug queries and the policy override
+var localhostNetworks = []string{"127.0.0.0/8", "::1/128"}
+
+// connStater is implemented by adapters backed by a database connection
+type connStater interface {
+	State() db.ConnState
+}
+
+// snapshotter is implemented by adapters that number their record set versions
+type snapshotter interface {
+	Generation() uint64
+	SnapshotAt() time.Time
+}
+
+// loadedAter is implemented by adapters that serve from an in-memory snapshot
+type loadedAter interface {
+	LoadedAt() time.Time
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func ipAllowed(acl []*net.IPNet, ipStr string) bool {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range acl {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotEDE returns an EDE naming the record set snapshot an answer came from, if
+// debug_snapshot is enabled
+func (p *PcePlugin) snapshotEDE(zone string, adapter util.Adapter) *dns.EDNS0_EDE {
+	if !p.debugSnapshot {
+		return nil
+	}
+	return &dns.EDNS0_EDE{
+		InfoCode:  dns.ExtendedErrorCodeOther,
+		ExtraText: fmt.Sprintf("snapshot=%s:%d", sourceFromZone(zone), adapterGeneration(adapter)),
+	}
+}
+
+// isDebugQuery reports whether the query should be answered with record attribution. Only
+// names this plugin answers are described; debug queries for any other name are left to
+// the next plugin.
+func (p *PcePlugin) isDebugQuery(qName string) bool {
+	if p.debugACL == nil || !strings.HasPrefix(qName, debugPrefix) {
+		return false
+	}
+	target := strings.TrimPrefix(qName, debugPrefix)
+	if _, pinned := p.pins[target]; pinned {
+		return true
+	}
+	zone := p.matchZone(target)
+	return zone != "" && p.inReverseScope(target, zone)
+}
+
+// serveDebug answers `_debug.<name>` with one TXT record per record backing <name>
+func (p *PcePlugin) serveDebug(ctx context.Context, state request.Request) (int, error) {
+	qName := state.Name()
+	if !ipAllowed(p.debugACL, state.IP()) {
+		log.Log.Warningf("debug: refusing query name=%q from %s", qName, state.IP())
+		return p.errorResponse(state, errDenied)
+	}
+
+	target := strings.TrimPrefix(qName, debugPrefix)
+	var lines []string
+	for _, pin := range p.pins[target] {
+		lines = append(lines, fmt.Sprintf("source=%s rr=%q", sourcePin, pin.String()))
+	}
+	zone := p.matchZone(target)
+	if zone == "" {
+		// Pinned outside the served zones
+		return p.serveDebugLines(state, lines)
+	}
+	adapter, err := p.adapterFromZone(zone)
+	if err != nil {
+		log.Log.Errorf("failed to get adapter for zone %q: %v", zone, err)
+		return p.errorResponse(state, err)
+	}
+
+	source := sourceFromZone(zone)
+	age := "live"
+	if la, ok := adapter.(loadedAter); ok {
+		age = util.Since(p.clock, la.LoadedAt()).Truncate(time.Second).String()
+	}
+
+	records, nameExists, err := adapter.LookupRecords(ctx, target, dns.TypeANY)
+	if cs, ok := adapter.(connStater); ok {
+		lines = append(lines, fmt.Sprintf("source=%s state=%s", source, cs.State()))
+	}
+	if s, ok := adapter.(snapshotter); ok {
+		lines = append(lines, fmt.Sprintf("source=%s snapshot=%d at=%s", source, s.Generation(), s.SnapshotAt().UTC().Format(time.RFC3339)))
+	}
+	switch {
+	case err != nil:
+		lines = append(lines, fmt.Sprintf("source=%s error=%q", source, err.Error()))
+	case len(records) == 0 && nameExists:
+		lines = append(lines, fmt.Sprintf("source=%s result=nodata", source))
+	case len(records) == 0:
+		lines = append(lines, fmt.Sprintf("source=%s result=nxdomain", source))
+	default:
+		attributeRecords(records, zone)
+		for _, record := range records {
+			lines = append(lines, fmt.Sprintf("source=%s age=%s rr=%q", record.Source, age, record.String()))
+		}
+	}
+	for _, record := range p.exclusion.Excluded(target) {
+		lines = append(lines, fmt.Sprintf("source=%s excluded rr=%q", record.Source, record.String()))
+	}
+	return p.serveDebugLines(state, lines)
+}
+
+// serveDebugLines answers a debug query with one TXT record per line
+func (p *PcePlugin) serveDebugLines(state request.Request, lines []string) (int, error) {
+	qName := state.Name()
+	txts := make([]util.Record, 0, len(lines))
+	for _, line := range lines {
+		txts = append(txts, util.Record{
+			FQDN:    qName,
+			Type:    dns.TypeTXT,
+			TTL:     debugTTL,
+			Content: util.RecordContent{Data: line},
+		})
+	}
+	answers, err := util.RecordsToRRs(txts)
+	if err != nil {
+		return p.errorResponse(state, err)
+	}
+	// Debug answers describe the zone data rather than being part of it, so AA is not set
+	resp := &response{rcode: dns.RcodeSuccess, answer: answers, compress: p.compress}
+	resp.write(state)
+	return dns.RcodeSuccess, nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+// newDebugTestPlugin allows debug queries from the test.ResponseWriter address
+func newDebugTestPlugin(t *testing.T) *PcePlugin {
+	t.Helper()
+	p := newChaseTestPlugin(t, `{"nodes":{"n1":"10.0.0.1"}}`, nil)
+	acl, err := parseCIDRs([]string{"10.240.0.1/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.debugACL = acl
+	return p
+}
+
+func TestDebugQueryScope(t *testing.T) {
+	p := newDebugTestPlugin(t)
+	p.pins = map[string][]util.Record{"pinned.example.com.": {addressRecord("pinned.example.com.", "10.9.9.9")}}
+
+	tests := map[string]bool{
+		"_debug.n1.bootstrap.pce.internal.": true,
+		"_debug.node.pce.internal.":         true,
+		"_debug.pinned.example.com.":        true,
+		"_debug.example.com.":               false,
+		"_debug.":                           false,
+		"n1.bootstrap.pce.internal.":        false,
+	}
+	for name, want := range tests {
+		if got := p.isDebugQuery(name); got != want {
+			t.Errorf("isDebugQuery(%q) = %t, expected %t", name, got, want)
+		}
+	}
+}
+
+func TestDebugQueryOutOfZonePassedOn(t *testing.T) {
+	p := newDebugTestPlugin(t)
+	p.Next = test.NextHandler(dns.RcodeRefused, nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion("_debug.example.com.", dns.TypeTXT)
+	rcode, err := p.ServeDNS(context.Background(), &test.ResponseWriter{}, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcode != dns.RcodeRefused {
+		t.Fatalf("expected the next plugin's rcode, got %s", dns.RcodeToString[rcode])
+	}
+}
+
+func TestDebugQueryAge(t *testing.T) {
+	p := newDebugTestPlugin(t)
+	clock := util.NewFakeClock(p.static.LoadedAt())
+	clock.Advance(90 * time.Second)
+	p.clock = clock
+
+	m := query(t, p, "_debug.n1.bootstrap.pce.internal.")
+	for _, rr := range m.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.Contains(strings.Join(txt.Txt, ""), "age=1m30s") {
+			return
+		}
+	}
+	t.Fatalf("expected a record aged 1m30s, got %v", m.Answer)
+}
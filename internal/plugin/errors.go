@@ -0,0 +1,72 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"errors"
+
+	"github.com/PextraCloud/pce-coredns/internal/db"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+var (
+	// errDenied is returned when the client is not allowed to make the query
+	errDenied = errors.New("query denied by ACL")
+	// errNotAuthoritative is returned for names outside the zones we serve
+	errNotAuthoritative = errors.New("name is not in a served zone")
+)
+
+// invalidQueryError is returned when the query itself is malformed
+type invalidQueryError struct {
+	reason string
+}
+
+func (e *invalidQueryError) Error() string { return "invalid query: " + e.reason }
+
+// rcodeForError maps an error to the response code and extended DNS error (RFC 8914)
+// sent to the client. Unclassified errors are SERVFAIL.
+func rcodeForError(err error) (int, *dns.EDNS0_EDE) {
+	var invalid *invalidQueryError
+	var queryErr *db.QueryError
+	switch {
+	case errors.As(err, &invalid):
+		return dns.RcodeFormatError, nil
+	case errors.Is(err, errDenied):
+		return dns.RcodeRefused, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeProhibited}
+	case errors.Is(err, errNotAuthoritative):
+		return dns.RcodeRefused, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeNotAuthoritative}
+	case errors.Is(err, errShedding):
+		return dns.RcodeServerFailure, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeNotReady, ExtraText: "overloaded"}
+	case errors.Is(err, db.ErrNotConnected):
+		return dns.RcodeServerFailure, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeNotReady}
+	case errors.Is(err, db.ErrBusy):
+		return dns.RcodeServerFailure, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeOther, ExtraText: "database busy"}
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, db.ErrQueryTimeout):
+		return dns.RcodeServerFailure, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeNoReachableAuthority, ExtraText: "database timeout"}
+	case errors.As(err, &queryErr):
+		return dns.RcodeServerFailure, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeNetworkError}
+	default:
+		return dns.RcodeServerFailure, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeOther}
+	}
+}
+
+// errorResponse answers with the rcode mapped from err
+func (p *PcePlugin) errorResponse(state request.Request, err error) (int, error) {
+	rcode, ede := rcodeForError(err)
+	return p.errResponse(state, rcode, ede, err)
+}
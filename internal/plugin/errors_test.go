@@ -0,0 +1,92 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/PextraCloud/pce-coredns/internal/db"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/lib/pq"
+	"github.com/miekg/dns"
+)
+
+func TestRcodeForError(t *testing.T) {
+	const noEDE = -1
+	tests := []struct {
+		name  string
+		err   error
+		rcode int
+		ede   int
+	}{
+		{name: "invalid query", err: &invalidQueryError{reason: "test"}, rcode: dns.RcodeFormatError, ede: noEDE},
+		{name: "denied", err: errDenied, rcode: dns.RcodeRefused, ede: int(dns.ExtendedErrorCodeProhibited)},
+		{name: "not authoritative", err: errNotAuthoritative, rcode: dns.RcodeRefused, ede: int(dns.ExtendedErrorCodeNotAuthoritative)},
+		{name: "shedding", err: errShedding, rcode: dns.RcodeServerFailure, ede: int(dns.ExtendedErrorCodeNotReady)},
+		{name: "not connected", err: db.ErrNotConnected, rcode: dns.RcodeServerFailure, ede: int(dns.ExtendedErrorCodeNotReady)},
+		{name: "busy", err: db.ErrBusy, rcode: dns.RcodeServerFailure, ede: int(dns.ExtendedErrorCodeOther)},
+		{name: "deadline", err: context.DeadlineExceeded, rcode: dns.RcodeServerFailure, ede: int(dns.ExtendedErrorCodeNoReachableAuthority)},
+		{name: "query timeout", err: &db.QueryError{Err: db.ErrQueryTimeout}, rcode: dns.RcodeServerFailure, ede: int(dns.ExtendedErrorCodeNoReachableAuthority)},
+		{name: "postgres error", err: &db.QueryError{Err: &pq.Error{Code: "42703"}}, rcode: dns.RcodeServerFailure, ede: int(dns.ExtendedErrorCodeNetworkError)},
+		{name: "network error", err: &db.QueryError{Err: io.ErrUnexpectedEOF}, rcode: dns.RcodeServerFailure, ede: int(dns.ExtendedErrorCodeNetworkError)},
+		{name: "wrapped", err: fmt.Errorf("lookup: %w", db.ErrNotConnected), rcode: dns.RcodeServerFailure, ede: int(dns.ExtendedErrorCodeNotReady)},
+		{name: "unclassified", err: errors.New("unknown"), rcode: dns.RcodeServerFailure, ede: int(dns.ExtendedErrorCodeOther)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcode, ede := rcodeForError(tt.err)
+			if rcode != tt.rcode {
+				t.Errorf("rcode = %s, expected %s", dns.RcodeToString[rcode], dns.RcodeToString[tt.rcode])
+			}
+			switch {
+			case tt.ede == noEDE && ede != nil:
+				t.Errorf("unexpected EDE %d", ede.InfoCode)
+			case tt.ede != noEDE && (ede == nil || int(ede.InfoCode) != tt.ede):
+				t.Errorf("EDE = %v, expected %d", ede, tt.ede)
+			}
+
+			// The reply carries the rcode and the EDE of clients sending EDNS
+			p := &PcePlugin{compress: true}
+			req := new(dns.Msg)
+			req.SetQuestion("n1.pce.internal.", dns.TypeA)
+			req.SetEdns0(dns.DefaultMsgSize, false)
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			if _, err := p.errorResponse(request.Request{W: rec, Req: req}, tt.err); !errors.Is(err, tt.err) {
+				t.Errorf("errorResponse returned %v", err)
+			}
+			if rec.Msg.Rcode != tt.rcode || rec.Msg.Authoritative {
+				t.Errorf("reply rcode %s, AA %t", dns.RcodeToString[rec.Msg.Rcode], rec.Msg.Authoritative)
+			}
+			var sent *dns.EDNS0_EDE
+			if opt := rec.Msg.IsEdns0(); opt != nil {
+				for _, o := range opt.Option {
+					if e, ok := o.(*dns.EDNS0_EDE); ok {
+						sent = e
+					}
+				}
+			}
+			if (sent == nil) != (tt.ede == noEDE) {
+				t.Errorf("reply EDE = %v, expected %d", sent, tt.ede)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"slices"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/request"
+)
+
+// FilterFunc post-processes the records found for a query before they are converted
+// into the answer. It may drop or modify records and must not retain the slice.
+type FilterFunc func(ctx context.Context, state request.Request, records []util.Record) []util.Record
+
+// NewSetup returns the setup function of plugin instances that run filters, in order,
+// over the records of every answer and its glue
+func NewSetup(filters ...FilterFunc) caddy.SetupFunc {
+	filters = slices.Clone(filters)
+	return func(c *caddy.Controller) error {
+		return setup(c, filters)
+	}
+}
+
+// applyFilters runs the plugin's filters over records in order
+func (p *PcePlugin) applyFilters(ctx context.Context, state request.Request, records []util.Record) []util.Record {
+	for _, f := range p.filters {
+		records = f(ctx, state, records)
+	}
+	return records
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// dropAddress returns a filter dropping the address records of ip
+func dropAddress(ip string) FilterFunc {
+	return func(_ context.Context, _ request.Request, records []util.Record) []util.Record {
+		kept := records[:0:0]
+		for _, r := range records {
+			if r.Content.IP == nil || r.Content.IP.String() != ip {
+				kept = append(kept, r)
+			}
+		}
+		return kept
+	}
+}
+
+// newFilterTestPlugin serves a SRV record whose target has two addresses
+func newFilterTestPlugin(t *testing.T, filters ...FilterFunc) *PcePlugin {
+	t.Helper()
+	p := newChaseTestPlugin(t, `{}`, []util.Record{
+		{FQDN: "_ceph._tcp.pce.internal.", Type: dns.TypeSRV, TTL: 30, Content: util.RecordContent{Priority: 10, Port: 6789, Target: "n1-ceph.pce.internal."}},
+		addressRecord("n1-ceph.pce.internal.", "10.1.0.1"),
+		addressRecord("n1-ceph.pce.internal.", "10.1.0.2"),
+	})
+	p.filters = filters
+	return p
+}
+
+// addresses returns the addresses of the A records in rrs
+func addresses(rrs []dns.RR) []string {
+	var ips []string
+	for _, rr := range rrs {
+		if a, ok := rr.(*dns.A); ok {
+			ips = append(ips, a.A.String())
+		}
+	}
+	return ips
+}
+
+func TestFiltersAnswer(t *testing.T) {
+	filtered := newFilterTestPlugin(t, dropAddress("10.1.0.2"))
+	if ips := addresses(query(t, filtered, "n1-ceph.pce.internal.").Answer); len(ips) != 1 || ips[0] != "10.1.0.1" {
+		t.Fatalf("filtered instance answered %v", ips)
+	}
+	// Filters belong to the instance they were set up with
+	unfiltered := newFilterTestPlugin(t)
+	if ips := addresses(query(t, unfiltered, "n1-ceph.pce.internal.").Answer); len(ips) != 2 {
+		t.Fatalf("instance without filters answered %v", ips)
+	}
+}
+
+func TestFiltersGlue(t *testing.T) {
+	p := newFilterTestPlugin(t, dropAddress("10.1.0.2"))
+	req := new(dns.Msg)
+	req.SetQuestion("_ceph._tcp.pce.internal.", dns.TypeSRV)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := p.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Msg.Answer) != 1 {
+		t.Fatalf("expected the SRV record, got %v", rec.Msg.Answer)
+	}
+	if ips := addresses(rec.Msg.Extra); len(ips) != 1 || ips[0] != "10.1.0.1" {
+		t.Fatalf("glue %v not filtered", ips)
+	}
+}
+
+func TestNewSetupFilters(t *testing.T) {
+	// Spare capacity an instance must not append into
+	filters := make([]FilterFunc, 1, 2)
+	filters[0] = dropAddress("10.1.0.1")
+	first, err := parseConfig(caddy.NewTestController("dns", "pce {\n mode static\n}"), filters...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := parseConfig(caddy.NewTestController("dns", "pce {\n mode static\n}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*PcePlugin{first, second} {
+		_ = p.static.Close()
+		p.scheduler.Stop()
+	}
+	if len(first.filters) != 1 || len(second.filters) != 0 {
+		t.Fatalf("instances have %d and %d filters, expected 1 and 0", len(first.filters), len(second.filters))
+	}
+	// Filters added by an instance, like the health prober's, stay with it
+	first.filters = append(first.filters, dropAddress("10.1.0.2"))
+	if filters[:2][1] != nil {
+		t.Fatal("instance filters share the caller's slice")
+	}
+}
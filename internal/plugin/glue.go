@@ -0,0 +1,76 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// glue returns the address records of in-zone SRV targets for the additional section,
+// passed through the filters like the answer. Glue is best effort: lookup failures leave
+// the additional section empty.
+func (p *PcePlugin) glue(ctx context.Context, state request.Request, zone string, adapter util.Adapter, records []util.Record) []dns.RR {
+	var targets []string
+	seen := map[string]struct{}{}
+	for _, record := range records {
+		if record.Type != dns.TypeSRV {
+			continue
+		}
+		target := dns.CanonicalName(record.Content.Target)
+		if _, dup := seen[target]; dup || !plugin.Name(zone).Matches(target) {
+			continue
+		}
+		seen[target] = struct{}{}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	var glue []util.Record
+	if aa, ok := adapter.(util.AddressAdapter); ok {
+		var err error
+		if glue, err = aa.LookupAddresses(ctx, targets); err != nil {
+			log.Log.Debugf("glue lookup failed: %v", err)
+			return nil
+		}
+	} else {
+		for _, target := range targets {
+			for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+				recs, _, err := adapter.LookupRecords(ctx, target, qtype)
+				if err != nil {
+					log.Log.Debugf("glue lookup failed for %q: %v", target, err)
+					return nil
+				}
+				glue = append(glue, recs...)
+			}
+		}
+	}
+
+	glue = p.applyFilters(ctx, state, glue)
+	extra, err := util.RecordsToRRs(glue)
+	if err != nil {
+		log.Log.Debugf("failed to convert glue records: %v", err)
+		return nil
+	}
+	return extra
+}
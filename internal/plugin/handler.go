@@ -17,24 +17,105 @@ package pce
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
 	"github.com/PextraCloud/pce-coredns/internal/util"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
 )
 
+// aborted reports whether the request context is done, in which case the client has
+// given up and no further work should be done for it.
+func aborted(ctx context.Context, stage string) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	log.Log.Debugf("request context done before %s: %v", stage, ctx.Err())
+	metrics.RequestsAborted.WithLabelValues(stage).Inc()
+	return true
+}
+
 func (p *PcePlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if p.mode == modeOff {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+	if aborted(ctx, "start") {
+		// Nobody is waiting for the answer, drop silently
+		return dns.RcodeSuccess, nil
+	}
+
 	state := request.Request{W: w, Req: r}
+	// Adapters may answer differently depending on the listener the query arrived on
+	ctx = util.WithLocalIP(ctx, state.LocalIP())
+	if n := len(r.Question); n != 1 {
+		metrics.BadQuestionCount.Inc()
+		if n == 0 || !p.firstQuestionOnly {
+			log.Log.Debugf("rejecting query with %d questions", n)
+			return p.errorResponse(state, &invalidQueryError{reason: "question count must be 1"})
+		}
+		// Only the first question is answered, and only it is echoed in the reply
+		log.Log.Debugf("answering first of %d questions", n)
+	}
+
+	// Name() is lowercased and fully qualified; adapters expect it in exactly this form
 	qName := state.Name()
 	qType := state.QType()
 	qTypeStr := state.Type()
 
+	trace := p.newTrace(qName, qTypeStr)
+	defer trace.emit(qType)
+
+	if err := validateQueryName(qName); err != nil {
+		trace.setResult("formerr")
+		log.Log.Debugf("rejecting query name=%q: %v", qName, err)
+		return p.errorResponse(state, err)
+	}
+
+	if isManagementRequest(state) {
+		trace.setResult("management")
+		return p.serveManagement(state)
+	}
+
+	switch classifyQType(qType) {
+	case qtypeMeta:
+		trace.setResult("formerr")
+		return p.errorResponse(state, &invalidQueryError{reason: qTypeStr + " is not valid as a question"})
+	case qtypeObsolete:
+		if p.notImpObsolete {
+			trace.setResult("notimp")
+			return p.errResponse(state, dns.RcodeNotImplemented, nil, nil)
+		}
+	}
+
+	if p.isVersionQuery(state) {
+		trace.setResult("version")
+		return p.serveVersion(state)
+	}
+
+	if p.isDebugQuery(qName) {
+		trace.setResult("debug")
+		return p.serveDebug(ctx, state)
+	}
+
+	if pins, ok := p.pins[qName]; ok {
+		trace.setResult("pinned")
+		return p.servePinned(state, pins)
+	}
+
+	// Names under a rewrite rule are looked up under the rule's target suffix
+	lookupName := p.rewriteName(qName)
+	if lookupName != qName {
+		trace.add("rewritten", lookupName)
+	}
+
 	// Check if name matches a zone we are authoritative for
-	zone := plugin.Zones(p.zones()).Matches(qName)
-	if zone == "" {
+	zone := p.matchZone(lookupName)
+	if zone == "" || !p.inReverseScope(lookupName, zone) {
 		log.Log.Debugf("zone not found for query name=%q, passing to next plugin", qName)
+		trace.setResult("not-in-zone")
 		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
 	}
 
@@ -46,13 +127,67 @@ func (p *PcePlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.M
 	if err != nil {
 		// This should never happen, since we only match zones we are authoritative for
 		log.Log.Errorf("failed to get adapter for zone %q: %v", zone, err)
-		// SERVFAIL
-		return errResponse(state, dns.RcodeServerFailure, err)
+		return p.errorResponse(state, err)
+	}
+	trace.add("zone", zone)
+	trace.add("source", sourceFromZone(zone))
+
+	negKey := negativeCacheKey{zone: zone, name: lookupName, qtype: qType}
+	if p.negativeCached(negKey, adapter) {
+		log.Log.Debugf("negative cache hit for name=%q type=%s", qName, qTypeStr)
+		metrics.NegativeCacheHits.WithLabelValues(zone).Inc()
+		trace.add("negative_cache", "hit")
+		return p.nxdomain(ctx, state, zone, adapter, trace)
+	}
+
+	// Lookups hitting the database are subject to load shedding
+	shed := p.shed != nil && sourceFromZone(zone) == util.SourceDB
+	if shed && !p.shed.begin() {
+		trace.setResult("shed")
+		return p.errorResponse(state, errShedding)
+	}
+	records, nameExists, err = adapter.LookupRecords(ctx, lookupName, qType)
+	if shed {
+		p.shed.done(err)
 	}
-	if records, nameExists, err = adapter.LookupRecords(ctx, qName, qType); err != nil {
+	if err != nil {
+		if aborted(ctx, "lookup") {
+			return dns.RcodeSuccess, nil
+		}
 		log.Log.Errorf("lookup failed for name=%q type=%s: %v", qName, qTypeStr, err)
-		// SERVFAIL
-		return errResponse(state, dns.RcodeServerFailure, err)
+		trace.add("error", fmt.Sprintf("%q", err))
+		if p.runtime().fall.Through(qName) {
+			// Another plugin may still answer for names we were told to pass on
+			trace.setResult("fallthrough")
+			return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+		}
+		trace.setResult("error")
+		return p.errorResponse(state, err)
+	}
+
+	trace.add("records", len(records))
+	trace.add("exists", nameExists)
+	authoritative, ede := p.answerAuthority(zone, adapter)
+	if !authoritative {
+		trace.add("stale", ede.ExtraText)
+	}
+	apex, apexExists := p.apexRecords(zone, lookupName, qType)
+	records = append(records, apex...)
+	nameExists = nameExists || apexExists
+
+	attributeRecords(records, zone)
+	if chased := p.chaseCNAMEs(ctx, records, qType); len(chased) > len(records) {
+		trace.add("chased", len(chased)-len(records))
+		records = chased
+	}
+	if len(p.filters) > 0 {
+		trace.add("before_filters", len(records))
+		records = p.applyFilters(ctx, state, records)
+		trace.add("after_filters", len(records))
+	}
+
+	if aborted(ctx, "response") {
+		return dns.RcodeSuccess, nil
 	}
 
 	hasRecords := len(records) > 0
@@ -61,46 +196,111 @@ func (p *PcePlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.M
 		var answers []dns.RR
 		if answers, err = util.RecordsToRRs(records); err != nil {
 			log.Log.Errorf("failed to convert records to RRs for name=%q type=%s: %v", qName, qTypeStr, err)
-			// SERVFAIL
-			return errResponse(state, dns.RcodeServerFailure, err)
+			trace.setResult("error")
+			return p.errorResponse(state, err)
 		}
+		restoreOwnerNames(answers, lookupName, qName)
+		extra := p.glue(ctx, state, zone, adapter, records)
 
+		if p.policyOverride(state) {
+			log.Log.Debugf("answer policy override for name=%q from %s", qName, state.IP())
+			trace.setResult("answer-override")
+			metadata, err := overrideMetadata(qName, zone, records)
+			if err != nil {
+				trace.setResult("error")
+				return p.errorResponse(state, err)
+			}
+			// Neither rotated nor capped, but the TTL policy still holds
+			p.runtime().applyTTLPolicy(answers)
+			// SUCCESS
+			return p.successResponse(state, answers, append(extra, metadata...), authoritative, ede)
+		}
+
+		trace.setResult("answer")
 		// SUCCESS
-		return successResponse(state, answers)
+		answers = p.runtime().shapeAnswers(answers, p.rotation.Add(1))
+		p.maintenanceTTLs(answers)
+		return p.successResponse(state, answers, extra, authoritative, ede)
 	}
 	if nameExists {
 		log.Log.Debugf("name exists but no records for type for name=%q type=%s", qName, qTypeStr)
+		trace.setResult("nodata")
 		// NOERROR (NODATA)
-		return successResponse(state, nil)
+		return p.negativeResponse(state, dns.RcodeSuccess, zone, authoritative, ede)
 	}
 
 	log.Log.Debugf("no records found for name=%q type=%s", qName, qTypeStr)
+	p.addNegative(negKey, adapter)
+	return p.nxdomain(ctx, state, zone, adapter, trace)
+}
+
+// nxdomain answers NXDOMAIN, or passes the query on if its name is in a fallthrough zone.
+// The decision is always made on the name as queried, never on the rewritten lookup name,
+// so rewrites cannot change which queries fall through.
+func (p *PcePlugin) nxdomain(ctx context.Context, state request.Request, zone string, adapter util.Adapter, trace *decisionTrace) (int, error) {
+	if p.runtime().fall.Through(state.Name()) {
+		log.Log.Debugf("falling through for name=%q", state.Name())
+		trace.setResult("fallthrough")
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, state.W, state.Req)
+	}
+	trace.setResult("nxdomain")
 	// NXDOMAIN
-	return errResponse(state, dns.RcodeNameError, nil)
+	authoritative, ede := p.answerAuthority(zone, adapter)
+	if authoritative {
+		// The snapshot is only named on answers and NODATA
+		ede = nil
+	}
+	return p.negativeResponse(state, dns.RcodeNameError, zone, authoritative, ede)
+}
+
+// answerAuthority returns the AA bit and EDE of replies decided from adapter's records.
+// Records the source has not confirmed, held in maintenance mode, left in a cache that
+// failed to refresh or seeded from a snapshot, are not authoritative and are answered
+// with a Stale Answer EDE.
+func (p *PcePlugin) answerAuthority(zone string, adapter util.Adapter) (bool, *dns.EDNS0_EDE) {
+	if p.maintenance != nil && p.maintenance.active.Load() {
+		return false, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeStaleAnswer, ExtraText: "maintenance"}
+	}
+	if s, ok := adapter.(util.StaleAdapter); ok {
+		if reason := s.Stale(); reason != "" {
+			return false, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeStaleAnswer, ExtraText: reason}
+		}
+	}
+	return true, p.snapshotEDE(zone, adapter)
 }
 
-func errResponse(state request.Request, rcode int, err error) (int, error) {
-	m := new(dns.Msg)
-	m.SetRcode(state.Req, rcode)
-	m.Authoritative = true
-	m.RecursionAvailable = false
-	m.Compress = true
+// validateQueryName rejects structurally invalid names (empty labels, labels over 63 octets,
+// names over 255 octets) before they reach the adapters
+func validateQueryName(name string) error {
+	if _, ok := dns.IsDomainName(name); !ok {
+		return &invalidQueryError{reason: "malformed query name"}
+	}
+	return nil
+}
 
-	state.SizeAndDo(m)
-	state.W.WriteMsg(m)
+// errResponse writes a non-authoritative error reply. NXDOMAIN, which is decided from our
+// zone data, is written by negativeResponse instead.
+func (p *PcePlugin) errResponse(state request.Request, rcode int, ede *dns.EDNS0_EDE, err error) (int, error) {
+	resp := &response{rcode: rcode, ede: ede, compress: p.compress}
+	resp.write(state)
+	if !plugin.ClientWrite(rcode) {
+		// Already written, don't let the server write a second reply
+		return dns.RcodeSuccess, err
+	}
 	return rcode, err
 }
 
-func successResponse(state request.Request, answers []dns.RR) (int, error) {
-	m := new(dns.Msg)
-	m.SetReply(state.Req)
-	m.Authoritative = true
-	m.RecursionAvailable = false
-	m.Compress = true
-	m.Answer = answers
-
-	state.SizeAndDo(m)
-	m = state.Scrub(m)
-	state.W.WriteMsg(m)
+// negativeResponse writes an NXDOMAIN or NODATA reply with the SOA of zone in the
+// authority section, so resolvers can cache it (RFC 2308)
+func (p *PcePlugin) negativeResponse(state request.Request, rcode int, zone string, authoritative bool, ede *dns.EDNS0_EDE) (int, error) {
+	resp := &response{rcode: rcode, ns: p.soaAuthority(zone), ede: ede, compress: p.compress, authoritative: authoritative}
+	resp.write(state)
+	return dns.RcodeSuccess, nil
+}
+
+// successResponse writes an answer from our zone data
+func (p *PcePlugin) successResponse(state request.Request, answers, extra []dns.RR, authoritative bool, ede *dns.EDNS0_EDE) (int, error) {
+	resp := &response{rcode: dns.RcodeSuccess, answer: answers, extra: extra, ede: ede, compress: p.compress, authoritative: authoritative}
+	resp.write(state)
 	return dns.RcodeSuccess, nil
 }
@@ -0,0 +1,238 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/static"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+// wireReply queries name with EDNS through p and returns the reply as it was sent
+func wireReply(t *testing.T, p *PcePlugin, name string) *dns.Msg {
+	t.Helper()
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := p.ServeDNS(context.Background(), rec, wireQuery(name, 1232, false)); err != nil {
+		t.Fatal(err)
+	}
+	packed, err := rec.Msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := new(dns.Msg)
+	if err := m.Unpack(packed); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// staleEDE returns the text of the Stale Answer EDE of m, if it has one
+func staleEDE(m *dns.Msg) (string, bool) {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return "", false
+	}
+	for _, o := range opt.Option {
+		if ede, ok := o.(*dns.EDNS0_EDE); ok && ede.InfoCode == dns.ExtendedErrorCodeStaleAnswer {
+			return ede.ExtraText, true
+		}
+	}
+	return "", false
+}
+
+func TestAnswerAuthority(t *testing.T) {
+	managementRow := []driver.Value{"n1", "10.0.0.1", "4", true, false, false, nil, "{management}"}
+	tests := []struct {
+		name  string
+		setup func(t *testing.T) *PcePlugin
+		qname string
+		rcode int
+		// stale is the expected Stale Answer EDE text, "" for an authoritative reply
+		stale string
+	}{
+		{
+			name: "database answer",
+			setup: func(t *testing.T) *PcePlugin {
+				d, mock := newMockDB(t)
+				expectNodeRecords(mock, managementRow)
+				p := newChaseTestPlugin(t, `{}`, nil)
+				p.db = d
+				return p
+			},
+			qname: "n1-management.pce.internal.",
+			rcode: dns.RcodeSuccess,
+		},
+		{
+			name: "static answer",
+			setup: func(t *testing.T) *PcePlugin {
+				return newChaseTestPlugin(t, `{"nodes":{"n1":"10.0.0.1"}}`, nil)
+			},
+			qname: "n1.bootstrap.pce.internal.",
+			rcode: dns.RcodeSuccess,
+		},
+		{
+			name: "stale cache",
+			setup: func(t *testing.T) *PcePlugin {
+				d, mock := newMockDB(t)
+				clock := util.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+				d.Clock = clock
+				d.CacheTTL = time.Minute
+				expectNodeRecords(mock, managementRow)
+				p := newChaseTestPlugin(t, `{}`, nil)
+				p.db = d
+				if m := wireReply(t, p, "n1-management.pce.internal."); !m.Authoritative {
+					t.Fatal("answer from a fresh cache is not authoritative")
+				}
+				clock.Advance(2 * time.Minute)
+				mock.ExpectQuery("FROM node_addresses").WillReturnError(errors.New("connection reset"))
+				return p
+			},
+			qname: "n1-management.pce.internal.",
+			rcode: dns.RcodeSuccess,
+			stale: util.StaleCache,
+		},
+		{
+			name: "seeded database answer",
+			setup: func(t *testing.T) *PcePlugin {
+				return newChaseTestPlugin(t, `{}`, []util.Record{addressRecord("n1.pce.internal.", "10.0.0.1")})
+			},
+			qname: "n1.pce.internal.",
+			rcode: dns.RcodeSuccess,
+			stale: util.StaleSeeded,
+		},
+		{
+			name: "seeded database nxdomain",
+			setup: func(t *testing.T) *PcePlugin {
+				return newChaseTestPlugin(t, `{}`, []util.Record{addressRecord("n1.pce.internal.", "10.0.0.1")})
+			},
+			qname: "n2.pce.internal.",
+			rcode: dns.RcodeNameError,
+			stale: util.StaleSeeded,
+		},
+		{
+			name: "seeded static answer",
+			setup: func(t *testing.T) *PcePlugin {
+				p := newChaseTestPlugin(t, `{}`, nil)
+				// Not started, the static file was never read
+				s := static.NewPlugin()
+				s.Seed([]util.Record{addressRecord("n1.bootstrap.pce.internal.", "10.0.0.1")})
+				p.static = s
+				return p
+			},
+			qname: "n1.bootstrap.pce.internal.",
+			rcode: dns.RcodeSuccess,
+			stale: util.StaleSeeded,
+		},
+		{
+			name: "maintenance answer",
+			setup: func(t *testing.T) *PcePlugin {
+				p := newChaseTestPlugin(t, `{"nodes":{"n1":"10.0.0.1"}}`, nil)
+				p.maintenance = &maintenanceMode{ttl: defaultMaintenanceTTL}
+				p.maintenance.active.Store(true)
+				return p
+			},
+			qname: "n1.bootstrap.pce.internal.",
+			rcode: dns.RcodeSuccess,
+			stale: "maintenance",
+		},
+		{
+			name: "maintenance nxdomain",
+			setup: func(t *testing.T) *PcePlugin {
+				p := newChaseTestPlugin(t, `{"nodes":{"n1":"10.0.0.1"}}`, nil)
+				p.maintenance = &maintenanceMode{ttl: defaultMaintenanceTTL}
+				p.maintenance.active.Store(true)
+				return p
+			},
+			qname: "n2.bootstrap.pce.internal.",
+			rcode: dns.RcodeNameError,
+			stale: "maintenance",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := wireReply(t, tt.setup(t), tt.qname)
+			if m.Rcode != tt.rcode {
+				t.Fatalf("rcode %s, expected %s", dns.RcodeToString[m.Rcode], dns.RcodeToString[tt.rcode])
+			}
+			if tt.rcode == dns.RcodeSuccess && len(m.Answer) == 0 {
+				t.Fatal("no answer")
+			}
+			if want := tt.stale == ""; m.Authoritative != want {
+				t.Fatalf("AA %t, expected %t", m.Authoritative, want)
+			}
+			text, ok := staleEDE(m)
+			if tt.stale == "" {
+				if ok {
+					t.Fatalf("authoritative reply has a Stale Answer EDE %q", text)
+				}
+				return
+			}
+			if !ok || text != tt.stale {
+				t.Fatalf("Stale Answer EDE %q (present %t), expected %q", text, ok, tt.stale)
+			}
+		})
+	}
+}
+
+func TestZonesDirective(t *testing.T) {
+	p := newChaseTestPlugin(t, `{"nodes":{"n1":"10.0.0.1"}}`, []util.Record{addressRecord("n1.pce.internal.", "10.0.1.1")})
+	p.servedZones = []string{util.ZoneDynamic}
+	p.Next = test.NextHandler(dns.RcodeRefused, nil)
+
+	tests := []struct {
+		name  string
+		qname string
+		// passed is set for queries passed on to the next plugin
+		passed bool
+		rcode  int
+	}{
+		{name: "in zone", qname: "n1.pce.internal.", rcode: dns.RcodeSuccess},
+		{name: "unknown name in zone", qname: "n2.pce.internal.", rcode: dns.RcodeNameError},
+		{name: "subdomain of a served zone", qname: "a.b.n1.pce.internal.", rcode: dns.RcodeNameError},
+		{name: "out of zone", qname: "example.org.", passed: true},
+		// The bootstrap zone is not served, so its names are not answered from the dynamic one
+		{name: "subdomain in an unserved zone", qname: "n1.bootstrap.pce.internal.", passed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			rcode, err := p.ServeDNS(context.Background(), rec, wireQuery(tt.qname, 0, false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.passed {
+				if rec.Msg != nil || rcode != dns.RcodeRefused {
+					t.Fatalf("answered %v instead of passing the query on", rec.Msg)
+				}
+				return
+			}
+			if rec.Msg == nil {
+				t.Fatal("query passed on")
+			}
+			if rec.Msg.Rcode != tt.rcode {
+				t.Fatalf("rcode %s, expected %s", dns.RcodeToString[rec.Msg.Rcode], dns.RcodeToString[tt.rcode])
+			}
+		})
+	}
+}
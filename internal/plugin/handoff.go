@@ -0,0 +1,80 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/db"
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+)
+
+const (
+	// defaultHandoffProbes is how many consecutive healthy db probes trigger the handoff
+	defaultHandoffProbes = 3
+	// handoffProbeInterval is how often the db is probed until the handoff happens
+	handoffProbeInterval = 5 * time.Second
+	// handoffProbeTimeout bounds a single db probe
+	handoffProbeTimeout = 2 * time.Second
+)
+
+// bootstrapHandoff tracks the move from the static bootstrap zone to the dynamic zone.
+// Once the db has loaded records for enough consecutive probes the handoff happens,
+// and it is never undone.
+type bootstrapHandoff struct {
+	// probes is the number of consecutive healthy db probes required
+	probes int
+	// cnameRole answers bootstrap node names with a CNAME to the node's name for this role
+	// in the dynamic zone ("" disables it)
+	cnameRole string
+
+	done atomic.Bool
+}
+
+// probe runs one db health check, returning the updated number of consecutive healthy probes
+func (h *bootstrapHandoff) probe(d *db.Plugin, healthy int) int {
+	ctx, cancel := context.WithTimeout(context.Background(), handoffProbeTimeout)
+	defer cancel()
+	n, err := d.Probe(ctx)
+	if err != nil || n == 0 {
+		return 0
+	}
+	healthy++
+	if healthy >= h.probes && !h.done.Swap(true) {
+		log.Log.Infof("handoff: dynamic zone healthy for %d probes, handing off from the bootstrap zone", healthy)
+		metrics.BootstrapHandoff.Set(1)
+	}
+	return healthy
+}
+
+// watchHandoff schedules the db probes, which stop counting once the handoff happened
+func (p *PcePlugin) watchHandoff() {
+	h := p.handoff
+	if h == nil {
+		return
+	}
+	healthy := 0
+	p.scheduler.Every("bootstrap_handoff", handoffProbeInterval, util.DefaultSchedulerJitter, func() error {
+		if !h.done.Load() {
+			healthy = h.probe(p.db, healthy)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// defaultProbeInterval is how often every served address is probed
+	defaultProbeInterval = 10 * time.Second
+	// maxProbeTimeout bounds a single dial
+	maxProbeTimeout = 2 * time.Second
+	// maxConcurrentProbes bounds the number of dials in flight
+	maxConcurrentProbes = 16
+	// probeFallThreshold is how many consecutive failed probes mark an address unhealthy
+	probeFallThreshold = 3
+	// probeRiseThreshold is how many consecutive successful probes mark it healthy again
+	probeRiseThreshold = 2
+)
+
+// healthProber dials the served addresses and filters unreachable ones out of answers.
+// State only changes after several consecutive results, so a single lost probe does not
+// make an address flap.
+type healthProber struct {
+	// port is the TCP port dialed on every address
+	port uint16
+	// interval is the time between probe cycles
+	interval time.Duration
+	// demote orders unhealthy addresses after healthy ones instead of dropping them
+	demote bool
+	// dial opens the probe connection
+	dial func(ctx context.Context, network, address string) (net.Conn, error)
+
+	mu sync.RWMutex
+	// health maps addresses to their state, addresses not in it are healthy
+	health map[string]*addressHealth
+
+	// ctx is cancelled by stopProber, aborting in-flight dials
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type addressHealth struct {
+	healthy bool
+	// streak is the number of consecutive results contradicting healthy
+	streak int
+}
+
+func newHealthProber(port uint16, interval time.Duration, demote bool) *healthProber {
+	ctx, cancel := context.WithCancel(context.Background())
+	var dialer net.Dialer
+	return &healthProber{
+		port:     port,
+		interval: interval,
+		demote:   demote,
+		dial:     dialer.DialContext,
+		health:   map[string]*addressHealth{},
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// timeout bounds a single dial, leaving room for the cycle to finish within the interval
+func (h *healthProber) timeout() time.Duration {
+	return min(h.interval/2, maxProbeTimeout)
+}
+
+// cycle probes every address and updates their state. Addresses no longer served are
+// forgotten.
+func (h *healthProber) cycle(addresses []string) error {
+	results := make([]bool, len(addresses))
+	g, ctx := errgroup.WithContext(h.ctx)
+	g.SetLimit(maxConcurrentProbes)
+	for i, address := range addresses {
+		g.Go(func() error {
+			dialCtx, cancel := context.WithTimeout(ctx, h.timeout())
+			defer cancel()
+			conn, err := h.dial(dialCtx, "tcp", net.JoinHostPort(address, strconv.Itoa(int(h.port))))
+			if err == nil {
+				_ = conn.Close()
+			}
+			results[i] = err == nil
+			return nil
+		})
+	}
+	_ = g.Wait()
+	if err := h.ctx.Err(); err != nil {
+		// Stopped mid-cycle, the results are meaningless
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	seen := make(map[string]struct{}, len(addresses))
+	for i, address := range addresses {
+		seen[address] = struct{}{}
+		h.observe(address, results[i])
+	}
+	for address := range h.health {
+		if _, ok := seen[address]; !ok {
+			delete(h.health, address)
+			metrics.AddressHealthy.DeleteLabelValues(address)
+		}
+	}
+	return nil
+}
+
+// observe applies one probe result with flap damping. h.mu must be held.
+func (h *healthProber) observe(address string, ok bool) {
+	state, known := h.health[address]
+	if !known {
+		state = &addressHealth{healthy: true}
+		h.health[address] = state
+	}
+	if ok == state.healthy {
+		state.streak = 0
+	} else {
+		state.streak++
+		threshold := probeFallThreshold
+		if ok {
+			threshold = probeRiseThreshold
+		}
+		if state.streak >= threshold {
+			state.healthy = ok
+			state.streak = 0
+			if ok {
+				log.Log.Infof("probe: %s is reachable again", address)
+			} else {
+				log.Log.Warningf("probe: %s unreachable on port %d, leaving it out of answers", address, h.port)
+			}
+		}
+	}
+	metrics.AddressHealthy.WithLabelValues(address).Set(boolToFloat(state.healthy))
+}
+
+// healthy reports whether the address is considered reachable
+func (h *healthProber) healthy(address string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	state, ok := h.health[address]
+	return !ok || state.healthy
+}
+
+// filter drops, or with demote moves to the end, address records of unreachable
+// addresses. If no reachable address is left the records are kept as they are, an
+// unreachable answer being more useful than none.
+func (h *healthProber) filter(ctx context.Context, state request.Request, records []util.Record) []util.Record {
+	var healthy, unhealthy []util.Record
+	for _, r := range records {
+		if (r.Type == dns.TypeA || r.Type == dns.TypeAAAA) && !h.healthy(r.Content.IP.String()) {
+			unhealthy = append(unhealthy, r)
+			continue
+		}
+		healthy = append(healthy, r)
+	}
+	if len(unhealthy) == 0 || !hasAddress(healthy) {
+		return records
+	}
+	if h.demote {
+		return append(healthy, unhealthy...)
+	}
+	return healthy
+}
+
+func hasAddress(records []util.Record) bool {
+	for _, r := range records {
+		if r.Type == dns.TypeA || r.Type == dns.TypeAAAA {
+			return true
+		}
+	}
+	return false
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// startProber schedules the probe cycles and filters answers by their results
+func (p *PcePlugin) startProber() {
+	if p.prober == nil {
+		return
+	}
+	p.filters = append(p.filters, p.prober.filter)
+	p.scheduler.EveryDedicated("health_probe", p.prober.interval, util.DefaultSchedulerJitter, p.probeAddresses)
+}
+
+// stopProber aborts the current probe cycle. The scheduler stops further cycles.
+func (p *PcePlugin) stopProber() {
+	if p.prober != nil {
+		p.prober.cancel()
+	}
+}
+
+// probeAddresses runs one probe cycle over the addresses currently served
+func (p *PcePlugin) probeAddresses() error {
+	seen := map[string]struct{}{}
+	var addresses []string
+	for _, snapshot := range []func() (uint64, []util.Record){p.db.Snapshot, p.static.Snapshot} {
+		_, records := snapshot()
+		for _, r := range records {
+			if r.Type != dns.TypeA && r.Type != dns.TypeAAAA {
+				continue
+			}
+			address := r.Content.IP.String()
+			if _, dup := seen[address]; !dup {
+				seen[address] = struct{}{}
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return p.prober.cycle(addresses)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+// listenerWriter is a test ResponseWriter receiving queries on a given local address
+type listenerWriter struct {
+	test.ResponseWriter
+	local net.IP
+}
+
+func (w *listenerWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: w.local, Port: 53}
+}
+
+// queryOn queries name for A records through a listener on local
+func queryOn(t *testing.T, p *PcePlugin, local, name string) []string {
+	t.Helper()
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+	rec := dnstest.NewRecorder(&listenerWriter{local: net.ParseIP(local)})
+	if _, err := p.ServeDNS(context.Background(), rec, req); err != nil {
+		t.Fatal(err)
+	}
+	ips := addresses(rec.Msg.Answer)
+	slices.Sort(ips)
+	return ips
+}
+
+func TestListenerRoleLookup(t *testing.T) {
+	d, mock := newMockDB(t)
+	// Loaded once, for every listener
+	d.CacheTTL = time.Minute
+	for _, mapping := range [][2]string{{"10.1.0.0/24", util.RoleManagement}, {"10.2.0.0/24", util.RoleReplication}} {
+		lr, err := util.ParseListenerRole(mapping[0], mapping[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.ListenerRoles = append(d.ListenerRoles, lr)
+	}
+	p := newChaseTestPlugin(t, `{}`, nil)
+	p.db = d
+
+	// n1 serves migration from both its management and its replication address
+	expectNodeRecords(mock,
+		[]driver.Value{"n1", "10.1.0.5", "4", true, false, false, nil, "{management,migration}"},
+		[]driver.Value{"n1", "10.2.0.5", "4", false, false, false, nil, "{replication,migration}"},
+	)
+	tests := []struct {
+		name     string
+		local    string
+		qname    string
+		expected []string
+	}{
+		{name: "management listener", local: "10.1.0.1", qname: "n1-migration.pce.internal.", expected: []string{"10.1.0.5"}},
+		{name: "replication listener", local: "10.2.0.1", qname: "n1-migration.pce.internal.", expected: []string{"10.2.0.5"}},
+		{name: "unmapped listener", local: "192.168.0.1", qname: "n1-migration.pce.internal.", expected: []string{"10.1.0.5", "10.2.0.5"}},
+		// A name served from a single address is answered whatever the listener
+		{name: "single address", local: "10.2.0.1", qname: "n1-management.pce.internal.", expected: []string{"10.1.0.5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ips := queryOn(t, p, tt.local, tt.qname); !slices.Equal(ips, tt.expected) {
+				t.Fatalf("answered %v, expected %v", ips, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// maintenanceCheckInterval is how often the maintenance file is checked
+const maintenanceCheckInterval = 5 * time.Second
+
+// defaultMaintenanceTTL is the TTL ceiling of answers served in maintenance mode
+const defaultMaintenanceTTL = 5
+
+// maintenanceRefreshTimeout bounds the refresh made when maintenance mode ends
+const maintenanceRefreshTimeout = 5 * time.Second
+
+// maintenanceMode serves the last known good records while the maintenance file exists.
+// Refreshes of both sources are paused, and answers carry clamped TTLs and a Stale Answer
+// EDE so that clients see the degraded state.
+type maintenanceMode struct {
+	// path is the file whose existence enables maintenance mode
+	path string
+	// ttl is the highest TTL served in maintenance mode
+	ttl uint32
+	// active is set while in maintenance mode
+	active atomic.Bool
+}
+
+// startMaintenance checks the maintenance file now and schedules the periodic checks
+func (p *PcePlugin) startMaintenance() {
+	if p.maintenance == nil {
+		return
+	}
+	_ = p.checkMaintenance()
+	p.scheduler.Every("maintenance_check", maintenanceCheckInterval, util.DefaultSchedulerJitter, p.checkMaintenance)
+}
+
+// checkMaintenance enters or leaves maintenance mode as the maintenance file appears or
+// disappears. Leaving it refreshes both sources right away.
+func (p *PcePlugin) checkMaintenance() error {
+	m := p.maintenance
+	_, err := os.Stat(m.path)
+	active := err == nil
+	if m.active.Load() == active {
+		return nil
+	}
+
+	p.db.SetPaused(active)
+	p.static.SetPaused(active)
+	m.active.Store(active)
+	metrics.MaintenanceMode.Set(boolToFloat(active))
+	if active {
+		log.Log.Warningf("maintenance: %s exists, entering maintenance mode and serving the last known records", m.path)
+		return nil
+	}
+
+	log.Log.Infof("maintenance: %s removed, leaving maintenance mode", m.path)
+	p.static.ReadStatic()
+	if p.mode != modeDB {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), maintenanceRefreshTimeout)
+	defer cancel()
+	if err := p.db.Refresh(ctx); err != nil {
+		log.Log.Warningf("maintenance: failed to refresh records from the database: %v", err)
+		return err
+	}
+	return nil
+}
+
+// maintenanceTTLs clamps the TTLs of answers served in maintenance mode. The answers are
+// not authoritative and carry a Stale Answer EDE, see answerAuthority.
+func (p *PcePlugin) maintenanceTTLs(answers []dns.RR) {
+	m := p.maintenance
+	if m == nil || !m.active.Load() {
+		return
+	}
+	for _, rr := range answers {
+		rr.Header().Ttl = min(rr.Header().Ttl, m.ttl)
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// isManagementRequest reports whether the request is a dynamic update or a zone transfer
+// rather than a plain query
+func isManagementRequest(state request.Request) bool {
+	if state.Req.Opcode == dns.OpcodeUpdate {
+		return true
+	}
+	qtype := state.QType()
+	return qtype == dns.TypeAXFR || qtype == dns.TypeIXFR
+}
+
+// serveManagement is the zone authority gate for updates and transfers: zones we do not
+// serve get NOTAUTH, and zones we serve get REFUSED since no principal is authorized to
+// update or transfer them
+func (p *PcePlugin) serveManagement(state request.Request) (int, error) {
+	zone := p.matchZone(state.Name())
+	if zone == "" {
+		log.Log.Debugf("management request for unmanaged zone name=%q from %s", state.Name(), state.IP())
+		metrics.ManagementRejected.WithLabelValues("unmanaged").Inc()
+		return p.errResponse(state, dns.RcodeNotAuth, nil, nil)
+	}
+	log.Log.Debugf("refusing management request for zone %q from %s", zone, state.IP())
+	metrics.ManagementRejected.WithLabelValues("unauthorized").Inc()
+	return p.errorResponse(state, errDenied)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PextraCloud/pce-coredns/internal/db"
+)
+
+// nodeRecordColumns are the columns of the node records query
+var nodeRecordColumns = []string{"node_id", "address", "address_family", "is_default", "dns_hidden", "dns_disabled", "dns_ttl", "address_roles"}
+
+// nodeRow is a default IPv4 address row of the node records query
+func nodeRow(node, address string) []driver.Value {
+	return []driver.Value{node, address, "4", true, false, false, nil, "{}"}
+}
+
+// newMockDB returns a db adapter connected to a sqlmock database, with the schema probe
+// already answered for the full role-aware schema
+func newMockDB(t *testing.T) (*db.Plugin, sqlmock.Sqlmock) {
+	t.Helper()
+	dsn := "pce " + t.Name()
+	conn, mock, err := sqlmock.NewWithDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery("information_schema").WillReturnRows(sqlmock.NewRows([]string{"addresses", "nodes", "dns_hidden", "dns_disabled", "dns_ttl"}).AddRow(true, true, true, true, true))
+
+	d := db.NewPlugin()
+	d.Driver = "sqlmock"
+	d.DataSource = dsn
+	d.Connect()
+	t.Cleanup(func() {
+		mock.ExpectClose()
+		_ = d.Close()
+		_ = conn.Close()
+	})
+	if d.State() != db.StateConnected {
+		t.Fatalf("mock database not connected: %s", d.State())
+	}
+	return d, mock
+}
+
+// expectNodeRecords expects one node records query answered with rows
+func expectNodeRecords(mock sqlmock.Sqlmock, rows ...[]driver.Value) {
+	result := sqlmock.NewRows(nodeRecordColumns)
+	for _, row := range rows {
+		result.AddRow(row...)
+	}
+	mock.ExpectQuery("FROM node_addresses").WillReturnRows(result)
+}
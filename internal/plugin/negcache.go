@@ -0,0 +1,69 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+)
+
+const (
+	// defaultNegativeTTL matches the default static refresh interval
+	defaultNegativeTTL = 5 * time.Second
+	// negativeCacheSize bounds the number of remembered NXDOMAIN names
+	negativeCacheSize = 10000
+)
+
+type negativeCacheKey struct {
+	zone  string
+	name  string
+	qtype uint16
+}
+
+// adapterGeneration returns the adapter's record set generation, or 0 if it does not track one
+func adapterGeneration(adapter util.Adapter) uint64 {
+	if g, ok := adapter.(util.Generational); ok {
+		return g.Generation()
+	}
+	return 0
+}
+
+// negativeCached reports whether the name is known not to exist in the adapter's current record set
+func (p *PcePlugin) negativeCached(key negativeCacheKey, adapter util.Adapter) bool {
+	if p.negCache == nil {
+		return false
+	}
+	generation, ok := p.negCache.Get(key)
+	if !ok {
+		return false
+	}
+	if generation != adapterGeneration(adapter) {
+		// Record set changed since the entry was added
+		p.negCache.Remove(key)
+		return false
+	}
+	return true
+}
+
+func (p *PcePlugin) addNegative(key negativeCacheKey, adapter util.Adapter) {
+	if p.negCache == nil {
+		return
+	}
+	p.negCache.Add(key, adapterGeneration(adapter))
+	metrics.RecordSetRecords.WithLabelValues("negative_cache").Set(float64(p.negCache.Len()))
+}
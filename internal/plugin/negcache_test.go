@@ -0,0 +1,74 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// newNegativeCacheTestPlugin serves the dynamic zone from a sqlmock database with the
+// negative cache enabled
+func newNegativeCacheTestPlugin(t *testing.T) (*PcePlugin, sqlmock.Sqlmock) {
+	t.Helper()
+	d, mock := newMockDB(t)
+	p := newChaseTestPlugin(t, `{}`, nil)
+	p.db = d
+	p.negCache = util.NewLRU[negativeCacheKey, uint64]("negative", negativeCacheSize, time.Minute)
+	return p, mock
+}
+
+func expectNXDOMAIN(t *testing.T, p *PcePlugin, name string) {
+	t.Helper()
+	if m := query(t, p, name); m.Rcode != dns.RcodeNameError {
+		t.Fatalf("expected NXDOMAIN for %s, got %s", name, dns.RcodeToString[m.Rcode])
+	}
+}
+
+func TestNegativeCacheRepeatedMiss(t *testing.T) {
+	p, mock := newNegativeCacheTestPlugin(t)
+	expectNodeRecords(mock, nodeRow("n1", "10.1.0.1"))
+
+	// Any query beyond the expected one fails the lookup with SERVFAIL
+	for range 3 {
+		expectNXDOMAIN(t, p, "missing.pce.internal.")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNegativeCacheClearedByRefresh(t *testing.T) {
+	p, mock := newNegativeCacheTestPlugin(t)
+	expectNodeRecords(mock, nodeRow("n1", "10.1.0.1"))
+	expectNXDOMAIN(t, p, "missing.pce.internal.")
+
+	// The refreshed record set changes the generation the entry was cached at
+	expectNodeRecords(mock, nodeRow("n1", "10.1.0.2"))
+	if err := p.db.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectNodeRecords(mock, nodeRow("n1", "10.1.0.2"))
+	expectNXDOMAIN(t, p, "missing.pce.internal.")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("miss after the refresh did not query the database: %v", err)
+	}
+}
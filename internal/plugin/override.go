@@ -0,0 +1,62 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"fmt"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultOverrideCode is the EDNS0 local option code requesting the unshaped record set
+	defaultOverrideCode = 65001
+	// Private-use EDNS0 option code range (RFC 6891)
+	minOverrideCode = 65001
+	maxOverrideCode = 65534
+)
+
+// policyOverride reports whether the query carries the answer policy override option
+// and comes from a network allowed to use it. Anything else is ignored.
+func (p *PcePlugin) policyOverride(state request.Request) bool {
+	if p.overrideACL == nil {
+		return false
+	}
+	opt := state.Req.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	for _, o := range opt.Option {
+		if local, ok := o.(*dns.EDNS0_LOCAL); ok && local.Code == p.overrideCode {
+			return ipAllowed(p.overrideACL, state.IP())
+		}
+	}
+	return false
+}
+
+// overrideMetadata describes the full record set for the additional section of overridden answers
+func overrideMetadata(qName, zone string, records []util.Record) ([]dns.RR, error) {
+	return util.RecordsToRRs([]util.Record{{
+		FQDN: qName,
+		Type: dns.TypeTXT,
+		TTL:  0,
+		Content: util.RecordContent{
+			Data: fmt.Sprintf("source=%s zone=%s records=%d", sourceFromZone(zone), zone, len(records)),
+		},
+	}})
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestPolicyOverride(t *testing.T) {
+	tests := []struct {
+		name string
+		// acl is the network allowed to override (test.ResponseWriter queries from 10.240.0.1)
+		acl        string
+		option     bool
+		answers    int
+		overridden bool
+	}{
+		{name: "authorized", acl: "10.240.0.0/16", option: true, answers: 3, overridden: true},
+		{name: "unauthorized", acl: "192.0.2.0/24", option: true, answers: 1},
+		{name: "absent option", acl: "10.240.0.0/16", answers: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newChaseTestPlugin(t, `{}`, []util.Record{
+				addressRecord("c.pce.internal.", "10.1.0.1"),
+				addressRecord("c.pce.internal.", "10.1.0.2"),
+				addressRecord("c.pce.internal.", "10.1.0.3"),
+			})
+			rc := &runtimeConfig{MaxAnswers: 1, TTLMin: 60, TTLMax: 120}
+			if err := rc.validate(); err != nil {
+				t.Fatal(err)
+			}
+			p.config.Store(rc)
+			acl, err := parseCIDRs([]string{tt.acl})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.overrideACL, p.overrideCode = acl, defaultOverrideCode
+
+			req := new(dns.Msg)
+			req.SetQuestion("c.pce.internal.", dns.TypeA)
+			req.SetEdns0(dns.DefaultMsgSize, false)
+			if tt.option {
+				opt := req.IsEdns0()
+				opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{Code: defaultOverrideCode})
+			}
+			rec := dnstest.NewRecorder(&test.ResponseWriter{})
+			if _, err := p.ServeDNS(context.Background(), rec, req); err != nil {
+				t.Fatal(err)
+			}
+
+			m := rec.Msg
+			if len(m.Answer) != tt.answers {
+				t.Fatalf("expected %d answer(s), got %v", tt.answers, m.Answer)
+			}
+			for _, rr := range m.Answer {
+				// The TTL floor applies whether or not the answer is overridden
+				if rr.Header().Ttl != 60 {
+					t.Fatalf("expected the TTL floor of 60, got %v", rr)
+				}
+			}
+			metadata := false
+			for _, rr := range m.Extra {
+				if rr.Header().Rrtype == dns.TypeTXT {
+					metadata = true
+				}
+			}
+			if metadata != tt.overridden {
+				t.Fatalf("expected metadata=%t, got additional section %v", tt.overridden, m.Extra)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// defaultPinTTL is the TTL of pinned records without an explicit ttl
+const defaultPinTTL = 30
+
+// sourcePin names records pinned in the Corefile
+const sourcePin = "pin"
+
+// parsePin parses the arguments of `pin <name> A|AAAA|CNAME <value> [ttl <seconds>]`
+func parsePin(args []string) (util.Record, error) {
+	if len(args) != 3 && len(args) != 5 {
+		return util.Record{}, fmt.Errorf("expected pin <name> A|AAAA|CNAME <value> [ttl <seconds>]")
+	}
+	name := dns.CanonicalName(args[0])
+	if _, ok := dns.IsDomainName(name); !ok {
+		return util.Record{}, fmt.Errorf("invalid pin name '%s'", args[0])
+	}
+
+	record := util.Record{FQDN: name, TTL: defaultPinTTL, Source: sourcePin}
+	switch typ, value := args[1], args[2]; typ {
+	case "A", "AAAA":
+		ip, err := util.ParseAddress(value)
+		if err != nil || (ip.To4() != nil) != (typ == "A") {
+			return util.Record{}, fmt.Errorf("invalid %s pin address '%s'", typ, value)
+		}
+		record.Type = dns.StringToType[typ]
+		record.Content.IP = ip
+	case "CNAME":
+		if _, ok := dns.IsDomainName(value); !ok {
+			return util.Record{}, fmt.Errorf("invalid CNAME pin target '%s'", value)
+		}
+		record.Type = dns.TypeCNAME
+		record.Content.CNAME = dns.CanonicalName(value)
+	default:
+		return util.Record{}, fmt.Errorf("unsupported pin type '%s', expected A, AAAA or CNAME", typ)
+	}
+
+	if len(args) == 5 {
+		if args[3] != "ttl" {
+			return util.Record{}, fmt.Errorf("unknown pin option '%s'", args[3])
+		}
+		ttl, err := strconv.ParseUint(args[4], 10, 32)
+		if err != nil || ttl == 0 || ttl > util.MaxRecordTTL {
+			return util.Record{}, fmt.Errorf("pin ttl must be between 1 and %d, got '%s'", util.MaxRecordTTL, args[4])
+		}
+		record.TTL = uint32(ttl)
+	}
+	return record, nil
+}
+
+// checkPins rejects pinned names mixing a CNAME with other records
+func checkPins(pins map[string][]util.Record) error {
+	for name, records := range pins {
+		for _, r := range records {
+			if r.Type == dns.TypeCNAME && len(records) > 1 {
+				return fmt.Errorf("pin %s has a CNAME and other records", name)
+			}
+		}
+	}
+	return nil
+}
+
+// servePinned answers a pinned name from its pins, which take precedence over every
+// source. Names pinned without records of the queried type get NODATA.
+func (p *PcePlugin) servePinned(state request.Request, pins []util.Record) (int, error) {
+	qName, qType := state.Name(), state.QType()
+	records, _ := util.MatchRecords(pins, qName, qType)
+	log.Log.Infof("pin: serving pinned answer for name=%q type=%s (%d record(s))", qName, state.Type(), len(records))
+	metrics.PinnedAnswers.WithLabelValues(qName).Inc()
+
+	if len(records) == 0 {
+		var ns []dns.RR
+		if zone := p.matchZone(qName); zone != "" {
+			ns = p.soaAuthority(zone)
+		}
+		resp := &response{rcode: dns.RcodeSuccess, ns: ns, compress: p.compress, authoritative: true}
+		resp.write(state)
+		return dns.RcodeSuccess, nil
+	}
+	answers, err := util.RecordsToRRs(records)
+	if err != nil {
+		return p.errorResponse(state, err)
+	}
+	return p.successResponse(state, answers, nil, true, nil)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import "github.com/miekg/dns"
+
+type qtypeClass int
+
+const (
+	// qtypeNormal types go through the lookup pipeline
+	qtypeNormal qtypeClass = iota
+	// qtypeMeta types only exist as pseudo-records and are invalid as questions (RFC 6895 3.1)
+	qtypeMeta
+	// qtypeObsolete types are obsolete and never served (RFC 1035 3.3, RFC 6895 3.1)
+	qtypeObsolete
+)
+
+// classifyQType decides how a question type is handled. Transfer types are not classified
+// here, they are handled by the management gate.
+func classifyQType(qtype uint16) qtypeClass {
+	switch qtype {
+	case dns.TypeOPT, dns.TypeTSIG, dns.TypeTKEY:
+		return qtypeMeta
+	case dns.TypeMD, dns.TypeMF, dns.TypeNULL, dns.TypeMAILA, dns.TypeMAILB:
+		return qtypeObsolete
+	default:
+		return qtypeNormal
+	}
+}
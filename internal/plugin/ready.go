@@ -0,0 +1,54 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"time"
+
+	"github.com/coredns/coredns/plugin/ready"
+)
+
+// defaultUnhealthyAfter is how long database loads may fail before the plugin reports
+// itself unhealthy
+const defaultUnhealthyAfter = 30 * time.Second
+
+// comp-time check: PcePlugin implements ready.Readiness, so the ready plugin polls it
+var _ ready.Readiness = (*PcePlugin)(nil)
+
+// Ready reports whether there is data to serve: the static file was read at least once,
+// or the database answered a ping. It reports not ready again while the plugin is not
+// healthy, which the ready plugin only sees with "monitor continuously".
+func (p *PcePlugin) Ready() bool {
+	switch {
+	case !p.Health():
+		return false
+	case p.mode == modeOff:
+		return true
+	case p.static.Generation() > 0:
+		return true
+	default:
+		return p.mode == modeDB && p.db.HasConnected()
+	}
+}
+
+// Health reports whether the plugin is healthy, which it stops being once database loads
+// have failed without a success for longer than unhealthyAfter
+func (p *PcePlugin) Health() bool {
+	if p.mode != modeDB || p.unhealthyAfter <= 0 {
+		return true
+	}
+	return p.db.FailingFor() <= p.unhealthyAfter
+}
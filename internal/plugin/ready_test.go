@@ -0,0 +1,86 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/db"
+	"github.com/PextraCloud/pce-coredns/internal/static"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/lib/pq"
+	"github.com/miekg/dns"
+)
+
+func TestReadyNeedsData(t *testing.T) {
+	// Neither the static file nor the database was ever read
+	p := &PcePlugin{mode: modeDB, db: db.NewPlugin(), static: static.NewPlugin(), unhealthyAfter: defaultUnhealthyAfter}
+	if p.Ready() {
+		t.Fatal("ready without data")
+	}
+	p.mode = modeOff
+	if !p.Ready() {
+		t.Fatal("mode off not ready")
+	}
+
+	// The static file alone is enough
+	p = newChaseTestPlugin(t, `{}`, nil)
+	if !p.Ready() {
+		t.Fatal("not ready once the static file was read")
+	}
+}
+
+func TestHealthThreshold(t *testing.T) {
+	clock := util.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	d, mock := newMockDB(t)
+	d.Clock = clock
+	p := &PcePlugin{mode: modeDB, db: d, static: static.NewPlugin(), unhealthyAfter: 30 * time.Second}
+	lookup := func() {
+		_, _, _ = d.LookupRecords(context.Background(), "n1-management.pce.internal.", dns.TypeA)
+	}
+	if !p.Ready() || !p.Health() {
+		t.Fatal("not ready and healthy once connected")
+	}
+
+	mock.ExpectQuery("FROM node_addresses").WillReturnError(&pq.Error{Code: "XX000"})
+	lookup()
+	clock.Advance(30 * time.Second)
+	if !p.Health() {
+		t.Fatal("unhealthy at the threshold")
+	}
+	clock.Advance(time.Second)
+	if p.Health() || p.Ready() {
+		t.Fatal("still healthy and ready after failing past the threshold")
+	}
+	// Disabled, failures never make the plugin unhealthy
+	p.unhealthyAfter = 0
+	if !p.Health() {
+		t.Fatal("unhealthy with unhealthy_after 0")
+	}
+	p.unhealthyAfter = 30 * time.Second
+
+	// A successful load makes it healthy again
+	expectNodeRecords(mock, nodeRow("n1", "10.0.0.1"))
+	lookup()
+	if !p.Health() || !p.Ready() {
+		t.Fatal("not healthy and ready after a successful load")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
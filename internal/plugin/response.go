@@ -0,0 +1,125 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// response collects the sections of a reply so features can add to them independently
+// before the single write path assembles the message.
+type response struct {
+	rcode  int
+	answer []dns.RR
+	ns     []dns.RR
+	extra  []dns.RR
+	// ede is attached to the OPT record if the client sent EDNS
+	ede *dns.EDNS0_EDE
+	// compress enables name compression
+	compress bool
+	// authoritative sets the AA bit. It is only set for answers from our own zone data,
+	// not for errors or synthesized answers (RFC 1035 4.1.1).
+	authoritative bool
+}
+
+// msg assembles the reply to the request: EDNS is negotiated first, then the EDE is
+// attached, and finally the message is truncated to fit the client's buffer. This is the
+// only place an OPT record is built, so every reply to an EDNS query, success or error,
+// carries exactly one OPT with the negotiated size and the DO bit echoed.
+func (resp *response) msg(state request.Request) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetRcode(state.Req, resp.rcode)
+	m.Authoritative = resp.authoritative
+	m.RecursionAvailable = false
+	m.Compress = resp.compress
+	m.Answer = resp.answer
+	m.Ns = resp.ns
+	m.Extra = withoutOPT(resp.extra)
+
+	state.SizeAndDo(m)
+	if opt := m.IsEdns0(); opt != nil && resp.ede != nil {
+		// SizeAndDo appends the request's own OPT record, the EDE goes on a copy
+		reply := dns.Copy(opt).(*dns.OPT)
+		reply.Option = append(reply.Option, resp.ede)
+		m.Extra[len(m.Extra)-1] = reply
+	}
+	if !resp.compress {
+		// Scrub would turn compression back on for large UDP replies; truncation accounts
+		// for the uncompressed size, so TC is set earlier instead
+		truncateUncompressed(m, state.Size())
+		return m
+	}
+	return state.Scrub(m)
+}
+
+// truncateUncompressed is dns.Msg.Truncate for replies that must not be compressed.
+// Truncate counts records at their compressed size and turns compression back on when a
+// reply does not fit, so here records are dropped until the uncompressed reply fits.
+func truncateUncompressed(m *dns.Msg, size int) {
+	m.Compress = false
+	size = max(size, dns.MinMsgSize)
+	if m.Len() <= size {
+		return
+	}
+
+	// The OPT record is always kept, at the end of the additional section
+	opt := m.IsEdns0()
+	if opt != nil {
+		size -= dns.Len(opt)
+	}
+	l := (&dns.Msg{Question: m.Question}).Len()
+	fits := func(rrs []dns.RR) []dns.RR {
+		for i, rr := range rrs {
+			l += dns.Len(rr)
+			if l > size {
+				// Nothing after the first record that does not fit is kept
+				l = size + 1
+				m.Truncated = true
+				return rrs[:i]
+			}
+		}
+		return rrs
+	}
+	m.Answer = fits(m.Answer)
+	m.Ns = fits(m.Ns)
+	m.Extra = fits(withoutOPT(m.Extra))
+	if opt != nil {
+		m.Extra = append(m.Extra, opt)
+	}
+}
+
+// withoutOPT drops stray OPT records from an additional section
+func withoutOPT(extra []dns.RR) []dns.RR {
+	for i, rr := range extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			continue
+		}
+		filtered := append([]dns.RR(nil), extra[:i]...)
+		for _, rr := range extra[i+1:] {
+			if rr.Header().Rrtype != dns.TypeOPT {
+				filtered = append(filtered, rr)
+			}
+		}
+		return filtered
+	}
+	return extra
+}
+
+// write sends the reply to the client
+func (resp *response) write(state request.Request) {
+	state.W.WriteMsg(resp.msg(state))
+}
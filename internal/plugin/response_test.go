@@ -0,0 +1,302 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/PextraCloud/pce-coredns/internal/db"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// responseGolden holds the packed replies of TestResponseGolden, one "name hex" per line
+const responseGolden = "testdata/response.golden"
+
+// responseKinds write each kind of reply through the response builder
+var responseKinds = []struct {
+	name  string
+	write func(p *PcePlugin, state request.Request)
+}{
+	{"noerror", func(p *PcePlugin, state request.Request) {
+		_, _ = p.successResponse(state, addressAnswers(state.Name(), 3), nil, true, nil)
+	}},
+	// Large enough that it only fits the buffer compressed, and is truncated otherwise
+	{"noerror-large", func(p *PcePlugin, state request.Request) {
+		_, _ = p.successResponse(state, addressAnswers(state.Name(), 40), nil, true, nil)
+	}},
+	{"nodata", func(p *PcePlugin, state request.Request) {
+		_, _ = p.negativeResponse(state, dns.RcodeSuccess, "pce.internal.", true, nil)
+	}},
+	{"nxdomain", func(p *PcePlugin, state request.Request) {
+		_, _ = p.negativeResponse(state, dns.RcodeNameError, "pce.internal.", true, nil)
+	}},
+	{"servfail", func(p *PcePlugin, state request.Request) {
+		_, _ = p.errorResponse(state, db.ErrNotConnected)
+	}},
+	{"refused", func(p *PcePlugin, state request.Request) {
+		_, _ = p.errorResponse(state, errDenied)
+	}},
+	{"formerr", func(p *PcePlugin, state request.Request) {
+		_, _ = p.errorResponse(state, &invalidQueryError{reason: "test"})
+	}},
+}
+
+// newResponseTestPlugin returns a plugin with a fixed SOA, enough to build every kind of
+// reply
+func newResponseTestPlugin(compress bool) *PcePlugin {
+	return &PcePlugin{
+		db:        db.NewPlugin(),
+		soaMname:  defaultSOAMname,
+		soaRname:  defaultSOARname,
+		soaSerial: 2026010100,
+		compress:  compress,
+	}
+}
+
+// addressAnswers returns n A records of name
+func addressAnswers(name string, n int) []dns.RR {
+	answers := make([]dns.RR, n)
+	for i := range answers {
+		answers[i] = &dns.A{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30},
+			A:   net.IPv4(10, 1, 0, byte(i+1)),
+		}
+	}
+	return answers
+}
+
+// wireQuery returns an A query for name, with EDNS if udpSize is set
+func wireQuery(name string, udpSize uint16, do bool) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+	req.Id = 0x5043
+	if udpSize > 0 {
+		req.SetEdns0(udpSize, do)
+	}
+	return req
+}
+
+// writeReply builds the reply of kind to req and returns it as sent
+func writeReply(t *testing.T, p *PcePlugin, write func(*PcePlugin, request.Request), req *dns.Msg) (*dns.Msg, []byte) {
+	t.Helper()
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	write(p, request.Request{W: rec, Req: req})
+	if rec.Msg == nil {
+		t.Fatal("no reply written")
+	}
+	packed, err := rec.Msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec.Msg, packed
+}
+
+func readGolden(t *testing.T) map[string]string {
+	t.Helper()
+	f, err := os.Open(responseGolden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	golden := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, packed, ok := strings.Cut(scanner.Text(), " ")
+		if ok {
+			golden[name] = packed
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return golden
+}
+
+// TestResponseGolden pins the packed replies of each kind, with and without EDNS and
+// compression, so that changes to the write path show up as wire changes
+func TestResponseGolden(t *testing.T) {
+	var golden map[string]string
+	if !*updateGolden {
+		golden = readGolden(t)
+	}
+	var updated strings.Builder
+	for _, kind := range responseKinds {
+		for _, edns := range []bool{false, true} {
+			for _, compress := range []bool{true, false} {
+				name := fmt.Sprintf("%s/edns=%t/compress=%t", kind.name, edns, compress)
+				t.Run(name, func(t *testing.T) {
+					var udpSize uint16
+					if edns {
+						udpSize = 1232
+					}
+					p := newResponseTestPlugin(compress)
+					_, packed := writeReply(t, p, kind.write, wireQuery("n1.pce.internal.", udpSize, edns))
+					got := hex.EncodeToString(packed)
+					if *updateGolden {
+						fmt.Fprintf(&updated, "%s %s\n", name, got)
+						return
+					}
+					if golden[name] != got {
+						t.Errorf("packed reply changed\n got: %s\nwant: %s", got, golden[name])
+					}
+				})
+			}
+		}
+	}
+	if *updateGolden {
+		if err := os.WriteFile(responseGolden, []byte(updated.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestResponseCompressOff checks that replies built with compression off carry no
+// compression pointers and are truncated at their uncompressed size
+func TestResponseCompressOff(t *testing.T) {
+	const answers = 40
+	large := func(p *PcePlugin, state request.Request) {
+		_, _ = p.successResponse(state, addressAnswers(state.Name(), answers), nil, true, nil)
+	}
+	owner := []byte("\x02n1\x03pce\x08internal\x00")
+
+	tests := []struct {
+		name      string
+		udpSize   uint16
+		truncated bool
+	}{
+		{name: "udp 512", udpSize: 0, truncated: true},
+		{name: "edns 1232", udpSize: 1232, truncated: true},
+		{name: "edns 4096", udpSize: 4096, truncated: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size := max(int(tt.udpSize), dns.MinMsgSize)
+			off, packedOff := writeReply(t, newResponseTestPlugin(false), large, wireQuery("n1.pce.internal.", tt.udpSize, false))
+			on, _ := writeReply(t, newResponseTestPlugin(true), large, wireQuery("n1.pce.internal.", tt.udpSize, false))
+
+			// Every name is written out in full: the question's and each answer's
+			if n := bytes.Count(packedOff, owner); n != 1+len(off.Answer) {
+				t.Errorf("found %d full owner names for %d answers, reply is compressed", n, len(off.Answer))
+			}
+			if len(packedOff) > size {
+				t.Errorf("uncompressed reply of %d bytes exceeds the %d byte buffer", len(packedOff), size)
+			}
+			if off.Truncated != tt.truncated {
+				t.Errorf("TC = %t, expected %t", off.Truncated, tt.truncated)
+			}
+			if tt.truncated && len(off.Answer) >= len(on.Answer) {
+				t.Errorf("uncompressed reply kept %d answers, compressed %d: TC not set earlier", len(off.Answer), len(on.Answer))
+			}
+			if !tt.truncated && len(off.Answer) != answers {
+				t.Errorf("kept %d of %d answers", len(off.Answer), answers)
+			}
+			if tt.udpSize > 0 && off.IsEdns0() == nil {
+				t.Error("OPT record dropped by truncation")
+			}
+		})
+	}
+}
+
+// optRecords returns the OPT records of the additional section
+func optRecords(m *dns.Msg) []*dns.OPT {
+	var opts []*dns.OPT
+	for _, rr := range m.Extra {
+		if opt, ok := rr.(*dns.OPT); ok {
+			opts = append(opts, opt)
+		}
+	}
+	return opts
+}
+
+// TestResponseSingleOPT checks that every kind of reply to an EDNS query carries exactly
+// one OPT record, last, with the negotiated size, the DO bit echoed and the EDE if any
+func TestResponseSingleOPT(t *testing.T) {
+	edeKinds := map[string]bool{"servfail": true, "refused": true}
+	for _, kind := range responseKinds {
+		for _, do := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/do=%t", kind.name, do), func(t *testing.T) {
+				req := wireQuery("n1.pce.internal.", 1232, do)
+				// Written twice, as the EDE must not pile up on the request's OPT record
+				for range 2 {
+					m, _ := writeReply(t, newResponseTestPlugin(true), kind.write, req)
+					opts := optRecords(m)
+					if len(opts) != 1 {
+						t.Fatalf("reply has %d OPT records", len(opts))
+					}
+					opt := opts[0]
+					if m.Extra[len(m.Extra)-1] != dns.RR(opt) {
+						t.Error("OPT record is not last in the additional section")
+					}
+					if opt.UDPSize() != 1232 || opt.Do() != do || opt.Version() != 0 {
+						t.Errorf("OPT size %d, DO %t, version %d", opt.UDPSize(), opt.Do(), opt.Version())
+					}
+					edes := 0
+					for _, o := range opt.Option {
+						if _, ok := o.(*dns.EDNS0_EDE); ok {
+							edes++
+						}
+					}
+					if expected := map[bool]int{true: 1}[edeKinds[kind.name]]; edes != expected {
+						t.Errorf("reply has %d EDE options, expected %d", edes, expected)
+					}
+				}
+				if n := len(req.IsEdns0().Option); n != 0 {
+					t.Errorf("request OPT record was given %d options", n)
+				}
+			})
+		}
+	}
+}
+
+func TestResponseNoOPTWithoutEDNS(t *testing.T) {
+	for _, kind := range responseKinds {
+		m, _ := writeReply(t, newResponseTestPlugin(true), kind.write, wireQuery("n1.pce.internal.", 0, false))
+		if opts := optRecords(m); len(opts) != 0 {
+			t.Errorf("%s: reply to a query without EDNS has %d OPT records", kind.name, len(opts))
+		}
+	}
+}
+
+func TestResponseStrayOPT(t *testing.T) {
+	stray := new(dns.OPT)
+	stray.Hdr = dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}
+	stray.SetUDPSize(512)
+	write := func(p *PcePlugin, state request.Request) {
+		_, _ = p.successResponse(state, addressAnswers(state.Name(), 1), []dns.RR{stray}, true, nil)
+	}
+	for _, udpSize := range []uint16{0, 1232} {
+		m, _ := writeReply(t, newResponseTestPlugin(true), write, wireQuery("n1.pce.internal.", udpSize, false))
+		expected := map[bool]int{true: 1}[udpSize > 0]
+		if opts := optRecords(m); len(opts) != expected {
+			t.Errorf("udp size %d: reply has %d OPT records, expected %d", udpSize, len(opts), expected)
+		} else if expected == 1 && opts[0].UDPSize() != udpSize {
+			t.Errorf("stray OPT record sent instead of the negotiated one")
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+const (
+	reverseSuffixV4 = "in-addr.arpa."
+	reverseSuffixV6 = "ip6.arpa."
+)
+
+// sourceReverse names the PTR records synthesized from the address records of the sources
+const sourceReverse = "reverse"
+
+// reverseZone returns the reverse zone containing every address of prefix. Prefixes not
+// on a label boundary (octets for IPv4, nibbles for IPv6) get the enclosing zone.
+func reverseZone(prefix *net.IPNet) string {
+	ones, bits := prefix.Mask.Size()
+	arpa, _ := dns.ReverseAddr(prefix.IP.String())
+	labels := dns.SplitDomainName(arpa)
+	// The address labels precede the two suffix labels
+	keep := ones / 8
+	if bits == net.IPv6len*8 {
+		keep = ones / 4
+	}
+	return dns.Fqdn(strings.Join(labels[len(labels)-2-keep:], "."))
+}
+
+// isReverseZone reports whether zone is under in-addr.arpa. or ip6.arpa.
+func isReverseZone(zone string) bool {
+	return dns.IsSubDomain(reverseSuffixV4, zone) || dns.IsSubDomain(reverseSuffixV6, zone)
+}
+
+// reverseIP parses the address of a full reverse name, returning nil for any other name
+func reverseIP(name string) net.IP {
+	var labels []string
+	switch {
+	case strings.HasSuffix(name, "."+reverseSuffixV4):
+		labels = dns.SplitDomainName(strings.TrimSuffix(name, "."+reverseSuffixV4))
+		if len(labels) != net.IPv4len {
+			return nil
+		}
+		slices.Reverse(labels)
+		return net.ParseIP(strings.Join(labels, ".")).To4()
+	case strings.HasSuffix(name, "."+reverseSuffixV6):
+		labels = dns.SplitDomainName(strings.TrimSuffix(name, "."+reverseSuffixV6))
+		if len(labels) != net.IPv6len*2 {
+			return nil
+		}
+		slices.Reverse(labels)
+		var hex strings.Builder
+		for i, nibble := range labels {
+			if len(nibble) != 1 {
+				return nil
+			}
+			if i > 0 && i%4 == 0 {
+				hex.WriteByte(':')
+			}
+			hex.WriteString(nibble)
+		}
+		ip := net.ParseIP(hex.String())
+		if ip == nil || ip.To4() != nil {
+			// IPv4-mapped addresses belong under in-addr.arpa.
+			return nil
+		}
+		return ip
+	default:
+		return nil
+	}
+}
+
+// inReverseScope reports whether name may be answered from zone. Reverse zones are
+// derived from the configured prefixes and may be wider, so names of addresses outside
+// the prefixes are not ours to answer.
+func (p *PcePlugin) inReverseScope(name, zone string) bool {
+	if !isReverseZone(zone) {
+		return true
+	}
+	ip := reverseIP(name)
+	if ip == nil {
+		return true
+	}
+	return slices.ContainsFunc(p.reverse, func(prefix *net.IPNet) bool { return prefix.Contains(ip) })
+}
+
+// reverseAdapter answers PTR queries with the names of the address records of its sources
+type reverseAdapter struct {
+	sources []util.ReverseAdapter
+}
+
+// comp-time check: reverseAdapter implements util.Adapter and util.Generational
+var _ util.Adapter = (*reverseAdapter)(nil)
+var _ util.Generational = (*reverseAdapter)(nil)
+
+// reverseSources returns the sources whose addresses get PTR records in mode
+func (p *PcePlugin) reverseSources() []util.ReverseAdapter {
+	if p.mode == modeStatic {
+		return []util.ReverseAdapter{p.static}
+	}
+	return []util.ReverseAdapter{p.db, p.static}
+}
+
+func (a *reverseAdapter) LookupRecords(ctx context.Context, name string, qtype uint16) ([]util.Record, bool, error) {
+	ip := reverseIP(name)
+	if ip == nil {
+		return nil, false, nil
+	}
+
+	var records []util.Record
+	var errs []error
+	seen := map[string]struct{}{}
+	for _, source := range a.sources {
+		addresses, err := source.LookupReverse(ctx, ip)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, r := range addresses {
+			if _, dup := seen[r.FQDN]; dup {
+				continue
+			}
+			seen[r.FQDN] = struct{}{}
+			records = append(records, util.Record{
+				FQDN:    name,
+				Type:    dns.TypePTR,
+				TTL:     r.TTL,
+				Content: util.RecordContent{Target: r.FQDN},
+				Source:  r.Source,
+			})
+		}
+	}
+	if len(errs) == len(a.sources) {
+		// No source could answer, don't claim the address has no names
+		return nil, false, errors.Join(errs...)
+	}
+	slices.SortFunc(records, func(x, y util.Record) int { return strings.Compare(x.Content.Target, y.Content.Target) })
+	matched, exists := util.MatchRecords(records, name, qtype)
+	return matched, exists, nil
+}
+
+// Generation changes whenever any source's record set changes
+func (a *reverseAdapter) Generation() uint64 {
+	var generation uint64
+	for _, source := range a.sources {
+		generation += adapterGeneration(source.(util.Adapter))
+	}
+	return generation
+}
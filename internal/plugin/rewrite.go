@@ -0,0 +1,74 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/miekg/dns"
+)
+
+// nameRewrite maps query names under one suffix onto another before lookup
+type nameRewrite struct {
+	from string
+	to   string
+}
+
+func newNameRewrite(from, to string) nameRewrite {
+	return nameRewrite{from: dns.CanonicalName(from), to: dns.CanonicalName(to)}
+}
+
+// checkRewrites warns about rules whose target lies under another rule's source. Such
+// chains are never followed, since a query name is rewritten at most once.
+func checkRewrites(rewrites []nameRewrite) {
+	for _, a := range rewrites {
+		for _, b := range rewrites {
+			if dns.IsSubDomain(b.from, a.to) {
+				log.Log.Warningf("config: rewrite %s -> %s maps into rewrite %s -> %s, which will not be applied again", a.from, a.to, b.from, b.to)
+			}
+		}
+	}
+}
+
+// rewriteName applies the first rewrite rule matching name. Names that would become
+// invalid after rewriting are left unchanged.
+func (p *PcePlugin) rewriteName(name string) string {
+	for _, rw := range p.rewrites {
+		if !dns.IsSubDomain(rw.from, name) {
+			continue
+		}
+		rewritten := name[:len(name)-len(rw.from)] + rw.to
+		if err := validateQueryName(rewritten); err != nil {
+			log.Log.Debugf("not rewriting name=%q: %v", name, err)
+			return name
+		}
+		log.Log.Debugf("rewrote name=%q to %q", name, rewritten)
+		return rewritten
+	}
+	return name
+}
+
+// restoreOwnerNames renames answers owned by the rewritten name back to the query name,
+// so clients see the name they asked for
+func restoreOwnerNames(answers []dns.RR, rewritten, original string) {
+	if rewritten == original {
+		return
+	}
+	for _, rr := range answers {
+		if rr.Header().Name == rewritten {
+			rr.Header().Name = original
+		}
+	}
+}
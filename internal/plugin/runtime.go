@@ -0,0 +1,293 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/fall"
+	"github.com/miekg/dns"
+)
+
+// defaultConfigInterval is how often the runtime config file is checked for changes
+const defaultConfigInterval = 5 * time.Second
+
+// Answer orders for names with both A and AAAA records
+const (
+	orderAsLoaded  = "as-loaded"
+	orderAAAAFirst = "aaaa-first"
+	orderAFirst    = "a-first"
+)
+
+// runtimeConfig holds the options that can be changed without reloading CoreDNS.
+// The live value is swapped atomically and must not be modified once published.
+type runtimeConfig struct {
+	// Fallthrough lists the zones whose NXDOMAIN answers are passed to the next plugin ("." for all)
+	Fallthrough []string `json:"fallthrough"`
+	// MaxAnswers caps the number of answer records (0 for unlimited)
+	MaxAnswers int `json:"max_answers"`
+	// TTLMin is the lowest TTL served (0 for no floor)
+	TTLMin uint32 `json:"ttl_min"`
+	// TTLMax is the highest TTL served (0 for no ceiling)
+	TTLMax uint32 `json:"ttl_max"`
+	// TTLJitter randomizes served TTLs within ±TTLJitter percent (0 for none)
+	TTLJitter int `json:"ttl_jitter"`
+	// Order is the address family order of names with both A and AAAA records ("" or
+	// orderAsLoaded keeps the loaded order)
+	Order string `json:"order"`
+	// RoundRobin rotates the address records of each RRset between responses
+	RoundRobin bool `json:"round_robin"`
+
+	// fall is the normalized form of Fallthrough
+	fall fall.F
+}
+
+// validate checks the config and normalizes the fallthrough zones
+func (rc *runtimeConfig) validate() error {
+	if rc.MaxAnswers < 0 {
+		return fmt.Errorf("max_answers must not be negative, got %d", rc.MaxAnswers)
+	}
+	if rc.TTLJitter < 0 || rc.TTLJitter > 100 {
+		return fmt.Errorf("ttl_jitter must be between 0 and 100, got %d", rc.TTLJitter)
+	}
+	if rc.TTLMax > 0 && rc.TTLMin > rc.TTLMax {
+		return fmt.Errorf("ttl_min (%d) is greater than ttl_max (%d)", rc.TTLMin, rc.TTLMax)
+	}
+	switch rc.Order {
+	case "", orderAsLoaded, orderAAAAFirst, orderAFirst:
+	default:
+		return fmt.Errorf("order must be %s, %s or %s, got '%s'", orderAAAAFirst, orderAFirst, orderAsLoaded, rc.Order)
+	}
+
+	zones := make([]string, 0, len(rc.Fallthrough))
+	for _, z := range rc.Fallthrough {
+		normalized := plugin.Host(z).NormalizeExact()
+		if len(normalized) == 0 {
+			return fmt.Errorf("invalid fallthrough zone '%s'", z)
+		}
+		zones = append(zones, normalized...)
+	}
+	rc.fall = fall.F{Zones: zones}
+	return nil
+}
+
+// clampTTL applies the TTL floor and ceiling to a record TTL
+func (rc *runtimeConfig) clampTTL(ttl uint32) uint32 {
+	if ttl < rc.TTLMin {
+		ttl = rc.TTLMin
+	}
+	if rc.TTLMax > 0 && ttl > rc.TTLMax {
+		ttl = rc.TTLMax
+	}
+	return ttl
+}
+
+// jitterFactor returns a random TTL multiplier within ±TTLJitter percent. One factor is
+// drawn per response so that the TTLs of an RRset stay equal.
+func (rc *runtimeConfig) jitterFactor() float64 {
+	if rc.TTLJitter == 0 {
+		return 1
+	}
+	return 1 + (rand.Float64()*2-1)*float64(rc.TTLJitter)/100
+}
+
+// shapeAnswers applies the rotation, answer limit, family order and TTL policy to the answer
+// section. The rotation comes before the limit so that every address is eventually served,
+// while the family order applies to the records left after it, so it never changes which
+// are served.
+func (rc *runtimeConfig) shapeAnswers(answers []dns.RR, rotation uint64) []dns.RR {
+	if rc.RoundRobin {
+		rotateAddresses(answers, rotation)
+	}
+	if rc.MaxAnswers > 0 && len(answers) > rc.MaxAnswers {
+		answers = answers[:rc.MaxAnswers]
+	}
+	rc.orderFamilies(answers)
+	rc.applyTTLPolicy(answers)
+	return answers
+}
+
+// applyTTLPolicy jitters the TTLs of answers and keeps them within the TTL floor and
+// ceiling. It applies to every answer, including those exempt from the rest of shaping.
+func (rc *runtimeConfig) applyTTLPolicy(answers []dns.RR) {
+	factor := rc.jitterFactor()
+	for _, rr := range answers {
+		ttl := uint32(math.Round(float64(rr.Header().Ttl) * factor))
+		if ttl == 0 && rr.Header().Ttl > 0 {
+			// Jitter never makes a cacheable record uncacheable
+			ttl = 1
+		}
+		// Jitter is applied first so that it never leaves the TTL floor and ceiling
+		rr.Header().Ttl = rc.clampTTL(ttl)
+	}
+}
+
+// rotateAddresses rotates the records of each A and AAAA RRset in place by rotation
+// positions. Records of other types keep their positions, so CNAMEs stay ahead of the
+// addresses they point to.
+func rotateAddresses(answers []dns.RR, rotation uint64) {
+	type rrset struct {
+		name  string
+		rtype uint16
+	}
+	positions := map[rrset][]int{}
+	var sets []rrset
+	for i, rr := range answers {
+		if t := rr.Header().Rrtype; t != dns.TypeA && t != dns.TypeAAAA {
+			continue
+		}
+		set := rrset{name: rr.Header().Name, rtype: rr.Header().Rrtype}
+		if _, ok := positions[set]; !ok {
+			sets = append(sets, set)
+		}
+		positions[set] = append(positions[set], i)
+	}
+	for _, set := range sets {
+		indexes := positions[set]
+		shift := int(rotation % uint64(len(indexes)))
+		if shift == 0 {
+			continue
+		}
+		rotated := make([]dns.RR, len(indexes))
+		for n := range indexes {
+			rotated[n] = answers[indexes[(n+shift)%len(indexes)]]
+		}
+		for n, i := range indexes {
+			answers[i] = rotated[n]
+		}
+	}
+}
+
+// orderFamilies reorders the address records of each owner name with both families in
+// place. Records of other types keep their positions, and each family keeps its order.
+func (rc *runtimeConfig) orderFamilies(answers []dns.RR) {
+	var first uint16
+	switch rc.Order {
+	case orderAAAAFirst:
+		first = dns.TypeAAAA
+	case orderAFirst:
+		first = dns.TypeA
+	default:
+		return
+	}
+
+	positions := map[string][]int{}
+	var owners []string
+	for i, rr := range answers {
+		if t := rr.Header().Rrtype; t != dns.TypeA && t != dns.TypeAAAA {
+			continue
+		}
+		owner := rr.Header().Name
+		if _, ok := positions[owner]; !ok {
+			owners = append(owners, owner)
+		}
+		positions[owner] = append(positions[owner], i)
+	}
+	for _, owner := range owners {
+		var preferred, rest []dns.RR
+		for _, i := range positions[owner] {
+			if answers[i].Header().Rrtype == first {
+				preferred = append(preferred, answers[i])
+			} else {
+				rest = append(rest, answers[i])
+			}
+		}
+		if len(preferred) == 0 || len(rest) == 0 {
+			// Single family
+			continue
+		}
+		for n, i := range positions[owner] {
+			if n < len(preferred) {
+				answers[i] = preferred[n]
+			} else {
+				answers[i] = rest[n-len(preferred)]
+			}
+		}
+	}
+}
+
+// runtime returns the live runtime config
+func (p *PcePlugin) runtime() *runtimeConfig {
+	return p.config.Load()
+}
+
+// readConfigFile loads the runtime config file over the Corefile values and swaps it in
+// if valid. Invalid files are rejected and the previous config is kept, while a deleted
+// file restores the Corefile values.
+func (p *PcePlugin) readConfigFile() {
+	file, err := os.Open(p.configFile)
+	if os.IsNotExist(err) && (p.configSize != 0 || !p.configMtime.IsZero()) {
+		p.configSize, p.configMtime = 0, time.Time{}
+		base := p.baseConfig
+		p.config.Store(&base)
+		log.Log.Infof("config: %s was removed, restored the Corefile config", p.configFile)
+		return
+	}
+	if err != nil {
+		log.Log.Debugf("config: failed to open file %s: %v", p.configFile, err)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		log.Log.Warningf("config: failed to stat file %s: %v", p.configFile, err)
+		return
+	}
+	if stat.Size() == p.configSize && stat.ModTime().Equal(p.configMtime) {
+		// No changes
+		return
+	}
+	p.configSize = stat.Size()
+	p.configMtime = stat.ModTime()
+
+	// Fields missing from the file keep their Corefile values
+	next := p.baseConfig
+	next.Fallthrough = append([]string(nil), p.baseConfig.Fallthrough...)
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&next); err != nil {
+		log.Log.Errorf("config: rejected %s, keeping previous config: %v", p.configFile, err)
+		return
+	}
+	if err := next.validate(); err != nil {
+		log.Log.Errorf("config: rejected %s, keeping previous config: %v", p.configFile, err)
+		return
+	}
+
+	p.config.Store(&next)
+	log.Log.Infof("config: applied runtime config from %s", p.configFile)
+}
+
+// watchConfigFile reads the runtime config file now and schedules the periodic checks
+func (p *PcePlugin) watchConfigFile() {
+	if p.configFile == "" {
+		return
+	}
+	p.readConfigFile()
+	p.scheduler.Every("config_file", defaultConfigInterval, util.DefaultSchedulerJitter, func() error {
+		p.readConfigFile()
+		return nil
+	})
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestReadConfigFileRemoved(t *testing.T) {
+	p := &PcePlugin{configFile: filepath.Join(t.TempDir(), "runtime.json")}
+	p.baseConfig = runtimeConfig{MaxAnswers: 5, Fallthrough: []string{"pce.internal."}}
+	if err := p.baseConfig.validate(); err != nil {
+		t.Fatal(err)
+	}
+	base := p.baseConfig
+	p.config.Store(&base)
+
+	// A missing file keeps the Corefile values
+	p.readConfigFile()
+	if p.runtime() != &base {
+		t.Fatal("config replaced while no file was ever read")
+	}
+
+	if err := os.WriteFile(p.configFile, []byte(`{"max_answers":2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p.readConfigFile()
+	if got := p.runtime().MaxAnswers; got != 2 {
+		t.Fatalf("expected max_answers 2 from the file, got %d", got)
+	}
+
+	if err := os.Remove(p.configFile); err != nil {
+		t.Fatal(err)
+	}
+	p.readConfigFile()
+	rc := p.runtime()
+	if rc.MaxAnswers != 5 || len(rc.fall.Zones) != 1 {
+		t.Fatalf("expected the Corefile config back, got %+v", rc)
+	}
+}
+
+func TestShapeAnswersJitterKeepsTTL(t *testing.T) {
+	rc := &runtimeConfig{TTLJitter: 100}
+	for range 1000 {
+		answers := []dns.RR{
+			&dns.A{Hdr: dns.RR_Header{Name: "a.pce.internal.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 1}},
+			&dns.TXT{Hdr: dns.RR_Header{Name: "a.pce.internal.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 0}},
+		}
+		answers = rc.shapeAnswers(answers, 0)
+		if ttl := answers[0].Header().Ttl; ttl < 1 || ttl > 2 {
+			t.Fatalf("jittered TTL %d outside [1, 2]", ttl)
+		}
+		if ttl := answers[1].Header().Ttl; ttl != 0 {
+			t.Fatalf("uncacheable record got TTL %d", ttl)
+		}
+	}
+}
@@ -16,33 +16,712 @@ limitations under the License.
 package pce
 
 import (
+	"cmp"
+	"errors"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/PextraCloud/pce-coredns/internal/db"
 	"github.com/PextraCloud/pce-coredns/internal/log"
 	"github.com/PextraCloud/pce-coredns/internal/static"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/PextraCloud/pce-coredns/internal/version"
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
 )
 
-func parseConfig(c *caddy.Controller) (*PcePlugin, error) {
+// schedulerWorkers bounds the number of short background jobs running at once. The health
+// probe, whose cycles can wait on unreachable addresses, runs on its own worker.
+const schedulerWorkers = 2
+
+func parseConfig(c *caddy.Controller, filters ...FilterFunc) (*PcePlugin, error) {
 	c.Next() // skip the PluginName token
 	log.Log.Debugf("config: parsing %s plugin", log.PluginName)
 
+	clock := util.RealClock
+	scheduler := util.NewScheduler(clock, schedulerWorkers)
 	s := static.NewPlugin()
+	s.Clock = clock
+	s.Scheduler = scheduler
 	d := db.NewPlugin()
+	d.Clock = clock
 
+	negativeTTL := defaultNegativeTTL
+	exclusion := &util.AddressExclusion{}
+	webhook := newWebhookSender("")
+	// webhookOption is the first webhook_* option seen, which require webhook_url
+	webhookOption := ""
 	pcePlugin := &PcePlugin{
-		db:     d,
-		static: s,
+		db:        d,
+		static:    s,
+		mode:      modeDB,
+		clock:     clock,
+		scheduler: scheduler,
+		compress:  true,
+		filters:   slices.Clone(filters),
+		soaMname:  defaultSOAMname,
+		soaRname:  defaultSOARname,
+
+		unhealthyAfter: defaultUnhealthyAfter,
 	}
 	if c.NextBlock() {
 		for {
 			switch c.Val() {
+			case "mode":
+				// mode db|static|off
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case modeDB, modeStatic, modeOff:
+					pcePlugin.mode = c.Val()
+				default:
+					return nil, c.Errf("invalid mode '%s', expected db, static or off", c.Val())
+				}
 			case "datasource":
 				if !c.NextArg() {
 					return nil, c.ArgErr()
 				}
 				pcePlugin.db.DataSource = c.Val()
+			case "bootstrap_ttl", "dynamic_ttl", "ttl":
+				// ttl is an alias of dynamic_ttl
+				option := c.Val()
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				ttl, err := strconv.ParseUint(c.Val(), 10, 32)
+				if err != nil || ttl == 0 || ttl > util.MaxRecordTTL {
+					return nil, c.Errf("%s must be between 1 and %d, got '%s'", option, util.MaxRecordTTL, c.Val())
+				}
+				if option == "bootstrap_ttl" {
+					pcePlugin.static.TTL = uint32(ttl)
+				} else {
+					pcePlugin.db.TTL = uint32(ttl)
+				}
+			case "negative_ttl":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				ttl, err := time.ParseDuration(c.Val())
+				if err != nil || ttl < 0 {
+					return nil, c.Errf("invalid negative_ttl '%s'", c.Val())
+				}
+				negativeTTL = ttl
+			case "debug_queries":
+				cidrs := c.RemainingArgs()
+				if len(cidrs) == 0 {
+					cidrs = localhostNetworks
+				}
+				acl, err := parseCIDRs(cidrs)
+				if err != nil {
+					return nil, c.Errf("invalid debug_queries network: %v", err)
+				}
+				pcePlugin.debugACL = acl
+			case "trace_decisions":
+				// trace_decisions [names...]
+				for _, name := range c.RemainingArgs() {
+					if _, ok := dns.IsDomainName(name); !ok {
+						return nil, c.Errf("invalid trace_decisions name '%s'", name)
+					}
+					pcePlugin.traceNames = append(pcePlugin.traceNames, dns.CanonicalName(name))
+				}
+				pcePlugin.traceDecisions = true
+			case "debug_snapshot":
+				pcePlugin.debugSnapshot = true
+			case "chaos_version":
+				pcePlugin.chaosVersion = true
+			case "fallthrough":
+				pcePlugin.baseConfig.Fallthrough = c.RemainingArgs()
+				if len(pcePlugin.baseConfig.Fallthrough) == 0 {
+					pcePlugin.baseConfig.Fallthrough = []string{"."}
+				}
+			case "max_answers":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid max_answers '%s'", c.Val())
+				}
+				pcePlugin.baseConfig.MaxAnswers = n
+			case "order":
+				// order aaaa-first|a-first|as-loaded, checked by validate
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				pcePlugin.baseConfig.Order = c.Val()
+			case "round_robin":
+				// round_robin on|off
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case "on":
+					pcePlugin.baseConfig.RoundRobin = true
+				case "off":
+					pcePlugin.baseConfig.RoundRobin = false
+				default:
+					return nil, c.Errf("invalid round_robin '%s', expected on or off", c.Val())
+				}
+			case "ttl_min", "ttl_max":
+				option := c.Val()
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				ttl, err := strconv.ParseUint(c.Val(), 10, 32)
+				if err != nil {
+					return nil, c.Errf("invalid %s '%s'", option, c.Val())
+				}
+				if option == "ttl_min" {
+					pcePlugin.baseConfig.TTLMin = uint32(ttl)
+				} else {
+					pcePlugin.baseConfig.TTLMax = uint32(ttl)
+				}
+			case "ttl_jitter":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				percent, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid ttl_jitter '%s'", c.Val())
+				}
+				pcePlugin.baseConfig.TTLJitter = percent
+			case "policy_override":
+				// policy_override [code] [networks...]
+				args := c.RemainingArgs()
+				pcePlugin.overrideCode = defaultOverrideCode
+				if len(args) > 0 {
+					code, err := strconv.ParseUint(args[0], 10, 16)
+					if err != nil || code < minOverrideCode || code > maxOverrideCode {
+						return nil, c.Errf("policy_override code must be between %d and %d, got '%s'", minOverrideCode, maxOverrideCode, args[0])
+					}
+					pcePlugin.overrideCode = uint16(code)
+					args = args[1:]
+				}
+				if len(args) == 0 {
+					args = localhostNetworks
+				}
+				acl, err := parseCIDRs(args)
+				if err != nil {
+					return nil, c.Errf("invalid policy_override network: %v", err)
+				}
+				pcePlugin.overrideACL = acl
+			case "static_max_size":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				size, err := strconv.ParseInt(c.Val(), 10, 64)
+				if err != nil || size < 0 {
+					return nil, c.Errf("invalid static_max_size '%s'", c.Val())
+				}
+				pcePlugin.static.MaxSize = size
+			case "static_max_nodes":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil || n < 0 {
+					return nil, c.Errf("invalid static_max_nodes '%s'", c.Val())
+				}
+				pcePlugin.static.MaxNodes = n
+			case "static_aliases":
+				// static_aliases records|cname
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case "records":
+					pcePlugin.static.AliasCNAME = false
+				case "cname":
+					pcePlugin.static.AliasCNAME = true
+				default:
+					return nil, c.Errf("invalid static_aliases '%s', expected records or cname", c.Val())
+				}
+			case "record_memory_limit":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				limit, err := strconv.ParseInt(c.Val(), 10, 64)
+				if err != nil || limit < 0 {
+					return nil, c.Errf("invalid record_memory_limit '%s'", c.Val())
+				}
+				pcePlugin.db.SoftLimit = limit
+				pcePlugin.static.SoftLimit = limit
+			case "name_format":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if err := db.ValidateNameFormat(c.Val()); err != nil {
+					return nil, c.Err(err.Error())
+				}
+				pcePlugin.db.NameFormat = c.Val()
+			case "role_port":
+				// role_port <role> <port>
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				port, err := strconv.ParseUint(args[1], 10, 16)
+				if err != nil || port == 0 {
+					return nil, c.Errf("invalid port '%s' for role '%s'", args[1], args[0])
+				}
+				pcePlugin.db.RolePorts[args[0]] = uint16(port)
+			case "soa":
+				// soa <mname> <rname> [serial]
+				args := c.RemainingArgs()
+				if len(args) < 2 || len(args) > 3 {
+					return nil, c.ArgErr()
+				}
+				// The mailbox may be given as an address
+				rname := strings.Replace(args[1], "@", ".", 1)
+				for _, name := range []string{args[0], rname} {
+					if _, ok := dns.IsDomainName(name); !ok {
+						return nil, c.Errf("invalid soa name '%s'", name)
+					}
+				}
+				pcePlugin.soaMname, pcePlugin.soaRname = dns.Fqdn(args[0]), dns.Fqdn(rname)
+				if len(args) == 3 {
+					serial, err := strconv.ParseUint(args[2], 10, 32)
+					if err != nil || serial == 0 {
+						return nil, c.Errf("invalid soa serial '%s'", args[2])
+					}
+					pcePlugin.soaSerial = uint32(serial)
+				}
+			case "reverse":
+				// reverse <prefix>...
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, arg := range args {
+					_, prefix, err := net.ParseCIDR(arg)
+					if err != nil {
+						return nil, c.Errf("invalid reverse prefix '%s'", arg)
+					}
+					pcePlugin.reverse = append(pcePlugin.reverse, prefix)
+					if zone := reverseZone(prefix); !slices.Contains(pcePlugin.reverseZones, zone) {
+						pcePlugin.reverseZones = append(pcePlugin.reverseZones, zone)
+					}
+				}
+			case "exclude_cidr":
+				// exclude_cidr <prefix>...
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, arg := range args {
+					_, prefix, err := net.ParseCIDR(arg)
+					if err != nil {
+						return nil, c.Errf("invalid exclude_cidr prefix '%s'", arg)
+					}
+					exclusion.Prefixes = append(exclusion.Prefixes, prefix)
+				}
+			case "exclude_substitute":
+				// exclude_substitute <address>..., at most one per family
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, arg := range args {
+					ip, err := util.ParseAddress(arg)
+					if err != nil {
+						return nil, c.Errf("invalid exclude_substitute address '%s'", arg)
+					}
+					substitute := &exclusion.Substitute6
+					if ip.To4() != nil {
+						ip, substitute = ip.To4(), &exclusion.Substitute4
+					}
+					if *substitute != nil {
+						return nil, c.Errf("duplicate exclude_substitute address '%s' for its family", arg)
+					}
+					*substitute = ip
+				}
+			case "pin":
+				// pin <name> A|AAAA|CNAME <value> [ttl <seconds>]
+				record, err := parsePin(c.RemainingArgs())
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				if pcePlugin.pins == nil {
+					pcePlugin.pins = map[string][]util.Record{}
+				}
+				pcePlugin.pins[record.FQDN] = append(pcePlugin.pins[record.FQDN], record)
+			case "zones":
+				// zones <zone>..., the available zones to serve (all by default)
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, arg := range args {
+					if zone := dns.CanonicalName(arg); !slices.Contains(pcePlugin.servedZones, zone) {
+						pcePlugin.servedZones = append(pcePlugin.servedZones, zone)
+					}
+				}
+			case "apex_txt":
+				// apex_txt <zone> <text>
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				// The zone is checked once mode and reverse are known
+				zone := dns.CanonicalName(args[0])
+				if pcePlugin.apexTXT == nil {
+					pcePlugin.apexTXT = map[string][]string{}
+				}
+				pcePlugin.apexTXT[zone] = append(pcePlugin.apexTXT[zone], args[1])
+			case "bootstrap_handoff":
+				// bootstrap_handoff auto [probes] [cname [role]]
+				args := c.RemainingArgs()
+				if len(args) == 0 || args[0] != "auto" {
+					return nil, c.Errf("bootstrap_handoff must start with 'auto'")
+				}
+				handoff := &bootstrapHandoff{probes: defaultHandoffProbes}
+				for i := 1; i < len(args); i++ {
+					if args[i] == "cname" {
+						// Bootstrap names are node ids, which only name a node's role
+						handoff.cnameRole = util.RoleClusterInternal
+						if i+1 < len(args) && slices.Contains(util.RolesList, args[i+1]) {
+							i++
+							handoff.cnameRole = args[i]
+						}
+						continue
+					}
+					n, err := strconv.Atoi(args[i])
+					if err != nil || n <= 0 {
+						return nil, c.Errf("invalid bootstrap_handoff argument '%s'", args[i])
+					}
+					handoff.probes = n
+				}
+				pcePlugin.handoff = handoff
+			case "bootstrap_cname":
+				// bootstrap_cname [role]
+				args := c.RemainingArgs()
+				if len(args) > 1 {
+					return nil, c.ArgErr()
+				}
+				role := util.RoleClusterInternal
+				if len(args) == 1 {
+					role = args[0]
+				}
+				if !slices.Contains(util.RolesList, role) {
+					return nil, c.Errf("unknown bootstrap_cname role '%s'", role)
+				}
+				pcePlugin.bootstrapCNAMERole = role
+			case "srv_priority":
+				// srv_priority <assigned> <fallback>
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				var priorities [2]uint16
+				for i, arg := range args {
+					v, err := strconv.ParseUint(arg, 10, 16)
+					if err != nil {
+						return nil, c.Errf("invalid SRV priority '%s'", arg)
+					}
+					priorities[i] = uint16(v)
+				}
+				pcePlugin.db.SRVPriority, pcePlugin.db.FallbackSRVPriority = priorities[0], priorities[1]
+			case "collision_policy":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				policy, err := util.ParseCollisionPolicy(c.Val())
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				pcePlugin.db.CollisionPolicy = policy
+				pcePlugin.static.CollisionPolicy = policy
+			case "self_node_id":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				pcePlugin.db.SelfNodeId = c.Val()
+			case "self_node_id_file":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				id, err := os.ReadFile(c.Val())
+				if err != nil {
+					return nil, c.Errf("failed to read self_node_id_file: %v", err)
+				}
+				pcePlugin.db.SelfNodeId = strings.TrimSpace(string(id))
+			case "listener_role":
+				// listener_role <local-prefix> <role>
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				lr, err := util.ParseListenerRole(args[0], args[1])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				pcePlugin.db.ListenerRoles = append(pcePlugin.db.ListenerRoles, lr)
+			case "max_concurrent_queries":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				n, err := strconv.ParseInt(c.Val(), 10, 64)
+				if err != nil || n <= 0 {
+					return nil, c.Errf("invalid max_concurrent_queries '%s'", c.Val())
+				}
+				pcePlugin.db.SetMaxConcurrentQueries(n)
+			case "slow_query_log":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				threshold, err := time.ParseDuration(c.Val())
+				if err != nil || threshold <= 0 {
+					return nil, c.Errf("invalid slow_query_log '%s'", c.Val())
+				}
+				pcePlugin.db.SlowQueryThreshold = threshold
+			case "query_timeout":
+				// query_timeout <duration>, 0 leaves queries bounded by the request only
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				timeout, err := time.ParseDuration(c.Val())
+				if err != nil || timeout < 0 {
+					return nil, c.Errf("invalid query_timeout '%s'", c.Val())
+				}
+				pcePlugin.db.QueryTimeout = timeout
+			case "cache_ttl":
+				// cache_ttl <duration> [floor <seconds>]
+				args := c.RemainingArgs()
+				if len(args) != 1 && len(args) != 3 {
+					return nil, c.ArgErr()
+				}
+				ttl, err := time.ParseDuration(args[0])
+				if err != nil || ttl < 0 {
+					return nil, c.Errf("invalid cache_ttl '%s'", args[0])
+				}
+				pcePlugin.db.CacheTTL = ttl
+				if len(args) == 3 {
+					if args[1] != "floor" {
+						return nil, c.Errf("unknown cache_ttl argument '%s'", args[1])
+					}
+					floor, err := strconv.ParseUint(args[2], 10, 32)
+					if err != nil {
+						return nil, c.Errf("invalid cache_ttl floor '%s'", args[2])
+					}
+					pcePlugin.db.CacheTTLFloor = uint32(floor)
+				}
+			case "probe":
+				// probe tcp <port> [interval <duration>] [demote]
+				args := c.RemainingArgs()
+				if len(args) < 2 {
+					return nil, c.ArgErr()
+				}
+				if args[0] != "tcp" {
+					return nil, c.Errf("unsupported probe protocol '%s', expected tcp", args[0])
+				}
+				port, err := strconv.ParseUint(args[1], 10, 16)
+				if err != nil || port == 0 {
+					return nil, c.Errf("invalid probe port '%s'", args[1])
+				}
+				interval, demote := defaultProbeInterval, false
+				for i := 2; i < len(args); i++ {
+					switch args[i] {
+					case "interval":
+						if i++; i == len(args) {
+							return nil, c.ArgErr()
+						}
+						if interval, err = time.ParseDuration(args[i]); err != nil || interval <= 0 {
+							return nil, c.Errf("invalid probe interval '%s'", args[i])
+						}
+					case "demote":
+						demote = true
+					default:
+						return nil, c.Errf("unknown probe option '%s'", args[i])
+					}
+				}
+				pcePlugin.prober = newHealthProber(uint16(port), interval, demote)
+			case "webhook_url":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				u, err := url.Parse(c.Val())
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return nil, c.Errf("invalid webhook_url '%s'", c.Val())
+				}
+				webhook.url = c.Val()
+			case "webhook_token_file":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				webhook.tokenFile = c.Val()
+				webhookOption = cmp.Or(webhookOption, "webhook_token_file")
+			case "webhook_timeout":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				timeout, err := time.ParseDuration(c.Val())
+				if err != nil || timeout <= 0 {
+					return nil, c.Errf("invalid webhook_timeout '%s'", c.Val())
+				}
+				webhook.timeout = timeout
+				webhookOption = cmp.Or(webhookOption, "webhook_timeout")
+			case "webhook_retries":
+				// webhook_retries <n> [backoff]
+				args := c.RemainingArgs()
+				if len(args) < 1 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				retries, err := strconv.Atoi(args[0])
+				if err != nil || retries < 0 {
+					return nil, c.Errf("invalid webhook_retries '%s'", args[0])
+				}
+				webhook.retries = retries
+				if len(args) == 2 {
+					if webhook.backoff, err = time.ParseDuration(args[1]); err != nil || webhook.backoff <= 0 {
+						return nil, c.Errf("invalid webhook_retries backoff '%s'", args[1])
+					}
+				}
+				webhookOption = cmp.Or(webhookOption, "webhook_retries")
+			case "webhook_batch_size":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				size, err := strconv.Atoi(c.Val())
+				if err != nil || size <= 0 {
+					return nil, c.Errf("invalid webhook_batch_size '%s'", c.Val())
+				}
+				webhook.batchSize = size
+				webhookOption = cmp.Or(webhookOption, "webhook_batch_size")
+			case "load_shedding":
+				// load_shedding <max_in_flight> [max_failure_ratio]
+				args := c.RemainingArgs()
+				if len(args) < 1 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				maxInFlight, err := strconv.Atoi(args[0])
+				if err != nil || maxInFlight <= 0 {
+					return nil, c.Errf("invalid load_shedding in-flight limit '%s'", args[0])
+				}
+				ratio := defaultShedFailureRatio
+				if len(args) == 2 {
+					if ratio, err = strconv.ParseFloat(args[1], 64); err != nil || ratio <= 0 || ratio > 1 {
+						return nil, c.Errf("invalid load_shedding failure ratio '%s'", args[1])
+					}
+				}
+				pcePlugin.shed = newShedder(maxInFlight, ratio)
+				pcePlugin.shed.clock = clock
+			case "compress":
+				// compress on|off
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case "on":
+					pcePlugin.compress = true
+				case "off":
+					pcePlugin.compress = false
+				default:
+					return nil, c.Errf("invalid compress '%s', expected on or off", c.Val())
+				}
+			case "rewrite":
+				// rewrite <from-suffix> <to-suffix>
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				for _, suffix := range args {
+					if _, ok := dns.IsDomainName(suffix); !ok {
+						return nil, c.Errf("invalid rewrite suffix '%s'", suffix)
+					}
+				}
+				pcePlugin.rewrites = append(pcePlugin.rewrites, newNameRewrite(args[0], args[1]))
+			case "startup_check":
+				// startup_check <name> <qtype>
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				qtype, ok := dns.StringToType[strings.ToUpper(args[1])]
+				if !ok {
+					return nil, c.Errf("unknown startup_check type '%s'", args[1])
+				}
+				pcePlugin.startupChecks = append(pcePlugin.startupChecks, startupCheck{name: args[0], qtype: qtype})
+			case "startup_check_strict":
+				pcePlugin.startupChecksStrict = true
+			case "obsolete_types":
+				// obsolete_types lookup|notimp
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case "lookup":
+					pcePlugin.notImpObsolete = false
+				case "notimp":
+					pcePlugin.notImpObsolete = true
+				default:
+					return nil, c.Errf("invalid obsolete_types '%s', expected lookup or notimp", c.Val())
+				}
+			case "multi_question":
+				// multi_question formerr|first
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case "formerr":
+					pcePlugin.firstQuestionOnly = false
+				case "first":
+					pcePlugin.firstQuestionOnly = true
+				default:
+					return nil, c.Errf("invalid multi_question '%s', expected formerr or first", c.Val())
+				}
+			case "snapshot_path":
+				// snapshot_path <path> [max_age]
+				args := c.RemainingArgs()
+				if len(args) < 1 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				pcePlugin.snapshotPath = args[0]
+				pcePlugin.snapshotMaxAge = defaultRecordSnapshotMaxAge
+				if len(args) == 2 {
+					maxAge, err := time.ParseDuration(args[1])
+					if err != nil || maxAge <= 0 {
+						return nil, c.Errf("invalid snapshot_path max age '%s'", args[1])
+					}
+					pcePlugin.snapshotMaxAge = maxAge
+				}
+			case "unhealthy_after":
+				// unhealthy_after <duration>, 0 never reports the plugin unhealthy
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil || d < 0 {
+					return nil, c.Errf("invalid unhealthy_after '%s'", c.Val())
+				}
+				pcePlugin.unhealthyAfter = d
+			case "maintenance_file":
+				// maintenance_file <path> [ttl]
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				pcePlugin.maintenance = &maintenanceMode{path: args[0], ttl: defaultMaintenanceTTL}
+				if len(args) == 2 {
+					ttl, err := strconv.ParseUint(args[1], 10, 32)
+					if err != nil || ttl == 0 {
+						return nil, c.Errf("invalid maintenance_file ttl '%s'", args[1])
+					}
+					pcePlugin.maintenance.ttl = uint32(ttl)
+				}
+			case "config_file":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				pcePlugin.configFile = c.Val()
 			default:
 				// Handle unexpected tokens
 				if c.Val() != "}" {
@@ -56,28 +735,145 @@ func parseConfig(c *caddy.Controller) (*PcePlugin, error) {
 		}
 	}
 
+	checkRewrites(pcePlugin.rewrites)
+	if err := checkPins(pcePlugin.pins); err != nil {
+		return nil, c.Err(err.Error())
+	}
+	for name := range pcePlugin.pins {
+		log.Log.Warningf("config: %s is pinned, its answers override every source until the pin is removed", name)
+	}
+	// Both hand bootstrap names over to the db, which static mode does not query
+	if pcePlugin.mode == modeStatic {
+		if pcePlugin.handoff != nil {
+			return nil, c.Errf("bootstrap_handoff cannot be used with mode %s", modeStatic)
+		}
+		if pcePlugin.bootstrapCNAMERole != "" {
+			return nil, c.Errf("bootstrap_cname cannot be used with mode %s", modeStatic)
+		}
+	}
+	for _, zone := range pcePlugin.servedZones {
+		if !slices.Contains(pcePlugin.availableZones(), zone) {
+			return nil, c.Errf("zone '%s' cannot be served in mode %s", zone, pcePlugin.mode)
+		}
+	}
+	for _, zone := range slices.Sorted(maps.Keys(pcePlugin.apexTXT)) {
+		if plugin.Zones(pcePlugin.zones()).Matches(zone) != zone {
+			return nil, c.Errf("apex_txt zone '%s' is not served by this plugin", zone)
+		}
+	}
+	if webhook.url != "" {
+		pcePlugin.webhook = webhook
+	} else if webhookOption != "" {
+		return nil, c.Errf("%s requires webhook_url", webhookOption)
+	}
+	if len(exclusion.Prefixes) > 0 {
+		for _, sub := range []net.IP{exclusion.Substitute4, exclusion.Substitute6} {
+			if sub != nil && exclusion.Excludes(sub) {
+				return nil, c.Errf("exclude_substitute address '%s' is itself excluded", sub)
+			}
+		}
+		pcePlugin.exclusion = exclusion
+		pcePlugin.db.Exclusion = exclusion
+		pcePlugin.static.Exclusion = exclusion
+	} else if exclusion.Substitute4 != nil || exclusion.Substitute6 != nil {
+		return nil, c.Errf("exclude_substitute requires exclude_cidr")
+	}
+	if err := pcePlugin.baseConfig.validate(); err != nil {
+		return nil, c.Err(err.Error())
+	}
+	base := pcePlugin.baseConfig
+	pcePlugin.config.Store(&base)
+	pcePlugin.zoneMatcher = util.NewZoneMatcher(pcePlugin.availableZones())
+
+	if negativeTTL > 0 {
+		pcePlugin.negCache = util.NewLRU[negativeCacheKey, uint64]("negative", negativeCacheSize, negativeTTL)
+	}
+
+	if pcePlugin.mode == modeOff {
+		// Inert: no database, no static file, every query is passed on
+		log.Log.Infof("config: %s plugin initialized in mode off, passing all queries on", log.PluginName)
+		c.OnShutdown(func() error {
+			pcePlugin.scheduler.Stop()
+			return nil
+		})
+		return pcePlugin, nil
+	}
+
+	// Subscribe the webhook before the sources load anything
+	pcePlugin.startWebhook()
 	// Attempt to connect to db
-	pcePlugin.db.Connect()
+	if pcePlugin.mode == modeDB {
+		pcePlugin.db.Connect()
+	}
 	// Start static plugin
-	pcePlugin.static.Start()
-	log.Log.Debugf("config: %s plugin initialized", log.PluginName)
+	if err := pcePlugin.static.Start(); err != nil {
+		pcePlugin.stopWebhook()
+		pcePlugin.scheduler.Stop()
+		return nil, err
+	}
+	// Keep serving from the last snapshot if the sources are unavailable, and keep it current
+	if pcePlugin.snapshotPath != "" {
+		pcePlugin.snapshotWritten = map[string]uint64{}
+		pcePlugin.loadRecordSnapshot()
+		pcePlugin.scheduler.Every("snapshot_write", recordSnapshotInterval, util.DefaultSchedulerJitter, pcePlugin.writeRecordSnapshot)
+	}
+	// Pause refreshes while the maintenance file exists
+	pcePlugin.startMaintenance()
+	// Probe the served addresses and leave unreachable ones out of answers
+	pcePlugin.startProber()
+	// Watch runtime config file
+	pcePlugin.watchConfigFile()
+	// Verify the lookup path before traffic arrives
+	if err := pcePlugin.runStartupChecks(); err != nil {
+		pcePlugin.stopProber()
+		pcePlugin.stopWebhook()
+		_ = pcePlugin.static.Close()
+		_ = pcePlugin.db.Close()
+		pcePlugin.scheduler.Stop()
+		return nil, c.Err(err.Error())
+	}
+	// Watch for the db taking over from the bootstrap zone
+	if pcePlugin.mode == modeDB {
+		pcePlugin.watchHandoff()
+	}
+	log.Log.Infof("config: %s plugin %s initialized (mode=%s, compress=%t)", log.PluginName, version.String(), pcePlugin.mode, pcePlugin.compress)
+
+	// Re-read the static file right away on reload instead of waiting for the next tick. The
+	// new instance adopted the previous one's file size and mtime, so its own first read
+	// skips a rewrite that kept both. OnStartup runs on the new instance only; an OnRestart
+	// hook would run on the instance being replaced.
+	c.OnStartup(func() error {
+		if pcePlugin.static != nil {
+			pcePlugin.static.ForceReload()
+		}
+		return nil
+	})
 
 	// Cleanup on shutdown
 	c.OnShutdown(func() error {
 		log.Log.Debugf("shutdown: %s plugin stopping", log.PluginName)
+		pcePlugin.stopProber()
+		pcePlugin.stopWebhook()
+		var errs []error
 		if pcePlugin.db != nil {
-			return pcePlugin.db.Close()
+			errs = append(errs, pcePlugin.db.Close())
 		}
 		if pcePlugin.static != nil {
-			return pcePlugin.static.Close()
+			errs = append(errs, pcePlugin.static.Close())
 		}
-		return nil
+		pcePlugin.scheduler.Stop()
+		return errors.Join(errs...)
 	})
 	return pcePlugin, nil
 }
 
+// Setup sets up a plugin instance without filters
 func Setup(c *caddy.Controller) error {
-	pce, err := parseConfig(c)
+	return setup(c, nil)
+}
+
+func setup(c *caddy.Controller, filters []FilterFunc) error {
+	pce, err := parseConfig(c, filters...)
 	if err != nil {
 		return err
 	}
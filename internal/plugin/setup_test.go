@@ -0,0 +1,239 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+// setupInstance runs Setup on input and returns the instance it added to the server,
+// stopped when the test ends
+func setupInstance(t *testing.T, input string) (*PcePlugin, error) {
+	t.Helper()
+	c := caddy.NewTestController("dns", input)
+	if err := Setup(c); err != nil {
+		return nil, err
+	}
+	handlers := dnsserver.GetConfig(c).Plugin
+	if len(handlers) != 1 {
+		t.Fatalf("setup added %d plugins, expected 1", len(handlers))
+	}
+	p := handlers[0](test.NextHandler(dns.RcodeSuccess, nil)).(*PcePlugin)
+	t.Cleanup(func() {
+		_ = p.static.Close()
+		_ = p.db.Close()
+		p.scheduler.Stop()
+	})
+	return p, nil
+}
+
+func TestSetupApexTXTZone(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		wantOK bool
+	}{
+		{
+			name:   "reverse zone declared after apex_txt",
+			input:  "pce {\n mode static\n apex_txt 10.in-addr.arpa. owner\n reverse 10.0.0.0/8\n}",
+			wantOK: true,
+		},
+		{
+			name:   "dynamic zone with mode static after apex_txt",
+			input:  "pce {\n apex_txt pce.internal. owner\n mode static\n}",
+			wantOK: false,
+		},
+		{
+			name:   "bootstrap zone with mode static after apex_txt",
+			input:  "pce {\n apex_txt bootstrap.pce.internal. owner\n mode static\n}",
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", tt.input)
+			p, err := parseConfig(c)
+			if ok := err == nil; ok != tt.wantOK {
+				t.Fatalf("expected ok=%t, got error %v", tt.wantOK, err)
+			}
+			if p != nil {
+				_ = p.static.Close()
+				p.scheduler.Stop()
+			}
+		})
+	}
+}
+
+func TestSetupBootstrapOptionsNeedDB(t *testing.T) {
+	for _, input := range []string{
+		"pce {\n bootstrap_handoff auto\n mode static\n}",
+		"pce {\n mode static\n bootstrap_handoff auto 5 cname\n}",
+		"pce {\n mode static\n bootstrap_cname\n}",
+	} {
+		c := caddy.NewTestController("dns", input)
+		if _, err := parseConfig(c); err == nil {
+			t.Errorf("expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestSetupCacheTTL(t *testing.T) {
+	tests := []struct {
+		input  string
+		wantOK bool
+		floor  uint32
+	}{
+		{input: "cache_ttl 30s", wantOK: true, floor: 1},
+		{input: "cache_ttl 30s floor 5", wantOK: true, floor: 5},
+		{input: "cache_ttl 30s floor 0", wantOK: true, floor: 0},
+		{input: "cache_ttl 30s floor", wantOK: false},
+		{input: "cache_ttl 30s ceiling 5", wantOK: false},
+		{input: "cache_ttl 30s floor -1", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			c := caddy.NewTestController("dns", "pce {\n mode static\n "+tt.input+"\n}")
+			p, err := parseConfig(c)
+			if ok := err == nil; ok != tt.wantOK {
+				t.Fatalf("expected ok=%t, got error %v", tt.wantOK, err)
+			}
+			if p == nil {
+				return
+			}
+			_ = p.static.Close()
+			p.scheduler.Stop()
+			if p.db.CacheTTLFloor != tt.floor {
+				t.Fatalf("floor %d, expected %d", p.db.CacheTTLFloor, tt.floor)
+			}
+		})
+	}
+}
+
+func TestSetupTwice(t *testing.T) {
+	// A reload sets the plugin up again in the same process. Validation keeps no state
+	// between setups, so the same Corefile is accepted or rejected every time.
+	tests := []struct {
+		input  string
+		wantOK bool
+	}{
+		{input: "pce {\n mode static\n ttl 30\n}", wantOK: true},
+		{input: "pce {\n mode static\n ttl -1\n}", wantOK: false},
+		{input: "pce {\n mode static\n bootstrap_cname\n}", wantOK: false},
+		{input: "pce {\n mode static\n cache_ttl 30s floor 5\n}", wantOK: true},
+	}
+	for round := 0; round < 2; round++ {
+		for _, tt := range tests {
+			_, err := setupInstance(t, tt.input)
+			if ok := err == nil; ok != tt.wantOK {
+				t.Fatalf("round %d: %q: expected ok=%t, got error %v", round, tt.input, tt.wantOK, err)
+			}
+		}
+	}
+}
+
+func TestSetupTwiceMetrics(t *testing.T) {
+	// The collectors are registered once when the metrics package is initialized, so
+	// instances set up on reload count into the same families
+	requests := metrics.Requests.WithLabelValues("A", "not-in-zone")
+	before := testutil.ToFloat64(requests)
+	for i := 0; i < 2; i++ {
+		p, err := setupInstance(t, "pce {\n mode static\n}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		if _, err := p.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := testutil.ToFloat64(requests) - before; got != 2 {
+		t.Fatalf("instances counted %v queries, expected 2", got)
+	}
+
+	// Gathering fails on families registered twice or with inconsistent labels
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := plugin.Namespace + "_" + log.PluginName + "_"
+	seen := map[string]bool{}
+	for _, family := range families {
+		name := family.GetName()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if seen[name] {
+			t.Fatalf("family %s gathered twice", name)
+		}
+		seen[name] = true
+	}
+	if !seen[prefix+"requests_total"] {
+		t.Fatalf("family %srequests_total not gathered", prefix)
+	}
+}
+
+func TestSetupZones(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		wantOK bool
+		zones  []string
+	}{
+		{name: "default", input: "mode db", wantOK: true, zones: []string{"pce.internal.", "bootstrap.pce.internal."}},
+		{name: "dynamic only", input: "zones PCE.internal", wantOK: true, zones: []string{"pce.internal."}},
+		{name: "bootstrap in mode static", input: "mode static\n zones bootstrap.pce.internal.", wantOK: true, zones: []string{"bootstrap.pce.internal."}},
+		{name: "reverse zone", input: "zones 10.in-addr.arpa. pce.internal.\n reverse 10.0.0.0/8", wantOK: true, zones: []string{"pce.internal.", "10.in-addr.arpa."}},
+		{name: "dynamic in mode static", input: "mode static\n zones pce.internal.", wantOK: false},
+		{name: "unknown zone", input: "zones example.org.", wantOK: false},
+		{name: "subdomain of a served zone", input: "zones sub.pce.internal.", wantOK: false},
+		{name: "undeclared reverse zone", input: "zones 10.in-addr.arpa.", wantOK: false},
+		{name: "no zones", input: "zones", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := caddy.NewTestController("dns", "pce {\n datasource host=/nonexistent\n "+tt.input+"\n}")
+			p, err := parseConfig(c)
+			if ok := err == nil; ok != tt.wantOK {
+				t.Fatalf("expected ok=%t, got error %v", tt.wantOK, err)
+			}
+			if p == nil {
+				return
+			}
+			_ = p.static.Close()
+			_ = p.db.Close()
+			p.scheduler.Stop()
+			if zones := p.zones(); !slices.Equal(zones, tt.zones) {
+				t.Fatalf("serving %v, expected %v", zones, tt.zones)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+)
+
+const (
+	// shedWindow is the period over which the lookup failure ratio is measured
+	shedWindow = 5 * time.Second
+	// shedMinSamples is the number of lookups in a window needed to judge the failure ratio
+	shedMinSamples = 20
+	// defaultShedFailureRatio is the failure ratio above which shedding starts
+	defaultShedFailureRatio = 0.5
+)
+
+// errShedding is returned for lookups rejected while shedding load
+var errShedding = errors.New("shedding load")
+
+// shedder detects sustained overload of the database backed lookups from the number of
+// lookups in flight and the recent failure ratio. It enters shed mode above the limits
+// and only leaves once both are back under half of them (hysteresis).
+type shedder struct {
+	// maxInFlight is the number of concurrent lookups above which shedding starts
+	maxInFlight int
+	// maxFailureRatio is the failure ratio above which shedding starts
+	maxFailureRatio float64
+	// clock is the source of time for the failure ratio window
+	clock util.Clock
+
+	mu       sync.Mutex
+	inFlight int
+	shedding bool
+	// windowStart, windowTotal and windowFailed track lookups in the current window
+	windowStart  time.Time
+	windowTotal  int
+	windowFailed int
+}
+
+func newShedder(maxInFlight int, maxFailureRatio float64) *shedder {
+	return &shedder{
+		maxInFlight:     maxInFlight,
+		maxFailureRatio: maxFailureRatio,
+		clock:           util.RealClock,
+		windowStart:     util.RealClock.Now(),
+	}
+}
+
+// begin registers a lookup, returning false if it must be shed instead. When true is
+// returned, done must be called with the lookup's result.
+func (s *shedder) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shedding {
+		// Re-evaluate without traffic reaching the database, so shedding can end
+		s.evaluate()
+	}
+	if s.shedding {
+		metrics.ShedDropped.Inc()
+		return false
+	}
+	s.inFlight++
+	s.evaluate()
+	return true
+}
+
+func (s *shedder) done(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inFlight--
+	s.windowTotal++
+	if err != nil {
+		s.windowFailed++
+	}
+	s.evaluate()
+}
+
+// evaluate switches shed mode on or off. It must be called with mu held.
+func (s *shedder) evaluate() {
+	if util.Since(s.clock, s.windowStart) > shedWindow {
+		s.windowStart = s.clock.Now()
+		s.windowTotal = 0
+		s.windowFailed = 0
+	}
+	ratio := 0.0
+	if s.windowTotal >= shedMinSamples {
+		ratio = float64(s.windowFailed) / float64(s.windowTotal)
+	}
+
+	if !s.shedding && (s.inFlight > s.maxInFlight || ratio > s.maxFailureRatio) {
+		s.shedding = true
+		metrics.ShedTransitions.WithLabelValues("enter").Inc()
+		log.Log.Warningf("shed: entering load shedding (in flight %d, failure ratio %.2f)", s.inFlight, ratio)
+	} else if s.shedding && s.inFlight <= s.maxInFlight/2 && ratio <= s.maxFailureRatio/2 {
+		s.shedding = false
+		metrics.ShedTransitions.WithLabelValues("exit").Inc()
+		log.Log.Infof("shed: leaving load shedding")
+	}
+}
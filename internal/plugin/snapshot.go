@@ -0,0 +1,141 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/db"
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+)
+
+const (
+	// recordSnapshotVersion is bumped on incompatible changes to the snapshot format
+	recordSnapshotVersion = 1
+	// recordSnapshotInterval is how often the record sets are checked for a new snapshot
+	recordSnapshotInterval = 30 * time.Second
+	// defaultRecordSnapshotMaxAge is the age above which a snapshot is not loaded
+	defaultRecordSnapshotMaxAge = 24 * time.Hour
+)
+
+// recordSnapshot is the on-disk copy of the served record sets, kept for disaster recovery
+type recordSnapshot struct {
+	Version   int                             `json:"version"`
+	WrittenAt time.Time                       `json:"written_at"`
+	Sources   map[string]recordSnapshotSource `json:"sources"`
+}
+
+type recordSnapshotSource struct {
+	Generation uint64        `json:"generation"`
+	Records    []util.Record `json:"records"`
+}
+
+// writeRecordSnapshot atomically writes the current record sets to snapshotPath, unless
+// neither changed since the last write
+func (p *PcePlugin) writeRecordSnapshot() error {
+	dbGen, dbRecords := p.db.Snapshot()
+	staticGen, staticRecords := p.static.Snapshot()
+	if dbGen == 0 && staticGen == 0 {
+		// Nothing real loaded yet, keep the previous snapshot
+		return nil
+	}
+	if dbGen == p.snapshotWritten[util.SourceDB] && staticGen == p.snapshotWritten[util.SourceStatic] {
+		return nil
+	}
+
+	snapshot := recordSnapshot{
+		Version:   recordSnapshotVersion,
+		WrittenAt: p.clock.Now().UTC(),
+		Sources: map[string]recordSnapshotSource{
+			util.SourceDB:     {Generation: dbGen, Records: dbRecords},
+			util.SourceStatic: {Generation: staticGen, Records: staticRecords},
+		},
+	}
+	data, err := json.Marshal(&snapshot)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial snapshot
+	tmp, err := os.CreateTemp(filepath.Dir(p.snapshotPath), ".pce-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), p.snapshotPath); err != nil {
+		return err
+	}
+
+	p.snapshotWritten[util.SourceDB] = dbGen
+	p.snapshotWritten[util.SourceStatic] = staticGen
+	log.Log.Debugf("snapshot: wrote db generation %d and static generation %d to %s", dbGen, staticGen, p.snapshotPath)
+	return nil
+}
+
+// readRecordSnapshot reads and checks the snapshot at snapshotPath
+func (p *PcePlugin) readRecordSnapshot() (*recordSnapshot, error) {
+	data, err := os.ReadFile(p.snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot recordSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("corrupted snapshot: %w", err)
+	}
+	if snapshot.Version != recordSnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+	if age := util.Since(p.clock, snapshot.WrittenAt); age > p.snapshotMaxAge {
+		return nil, fmt.Errorf("snapshot is %s old, over the limit of %s", age.Truncate(time.Second), p.snapshotMaxAge)
+	}
+	return &snapshot, nil
+}
+
+// loadRecordSnapshot seeds the adapters whose source is unavailable at startup from the
+// snapshot, so they keep answering until the source recovers
+func (p *PcePlugin) loadRecordSnapshot() {
+	snapshot, err := p.readRecordSnapshot()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Log.Warningf("snapshot: ignoring %s: %v", p.snapshotPath, err)
+		}
+		return
+	}
+
+	if src, ok := snapshot.Sources[util.SourceDB]; ok && p.mode == modeDB && p.db.State() != db.StateConnected {
+		p.db.Seed(src.Records)
+	}
+	if src, ok := snapshot.Sources[util.SourceStatic]; ok {
+		// Ignored by the static adapter once its file was read
+		p.static.Seed(src.Records)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+func TestRecordSnapshotMaxAge(t *testing.T) {
+	clock := util.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	p := newChaseTestPlugin(t, `{"nodes":{"n1":"10.0.0.1"}}`, nil)
+	p.clock = clock
+	p.snapshotPath = filepath.Join(t.TempDir(), "snapshot.json")
+	p.snapshotMaxAge = time.Hour
+	p.snapshotWritten = map[string]uint64{}
+
+	if err := p.writeRecordSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	snapshot, err := p.readRecordSnapshot()
+	if err != nil {
+		t.Fatalf("snapshot at the age limit rejected: %v", err)
+	}
+	if !snapshot.WrittenAt.Equal(clock.Now().Add(-time.Hour)) {
+		t.Fatalf("snapshot written at %s", snapshot.WrittenAt)
+	}
+
+	clock.Advance(time.Second)
+	if _, err := p.readRecordSnapshot(); err == nil {
+		t.Fatal("snapshot over the age limit was accepted")
+	}
+}
+
+func TestRecordSnapshotAtomicWrite(t *testing.T) {
+	dir := t.TempDir()
+	p := newChaseTestPlugin(t, `{"nodes":{"n1":"10.0.0.1"}}`, nil)
+	p.clock = util.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	p.snapshotPath = filepath.Join(dir, "snapshot.json")
+	p.snapshotMaxAge = time.Hour
+	p.snapshotWritten = map[string]uint64{}
+
+	if err := p.writeRecordSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	// Only the snapshot is left, never a temporary file
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "snapshot.json" {
+		t.Fatalf("directory holds %v, expected only the snapshot", entries)
+	}
+	snapshot, err := p.readRecordSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src := snapshot.Sources[util.SourceStatic]; src.Generation != 1 || len(src.Records) != 1 {
+		t.Fatalf("static source %+v, expected generation 1 with 1 record", src)
+	}
+
+	// A failed write leaves nothing behind
+	p.snapshotPath = dir
+	p.snapshotWritten = map[string]uint64{}
+	if err := p.writeRecordSnapshot(); err == nil {
+		t.Fatal("snapshot written over a directory")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("failed write left %v", entries)
+	}
+}
+
+func TestRecordSnapshotColdStart(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	data, err := json.Marshal(&recordSnapshot{
+		Version:   recordSnapshotVersion,
+		WrittenAt: now.Add(-time.Minute),
+		Sources: map[string]recordSnapshotSource{
+			util.SourceDB: {Generation: 7, Records: []util.Record{addressRecord("n1.pce.internal.", "10.0.0.1")}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The database was never reached
+	p := newChaseTestPlugin(t, `{}`, nil)
+	p.clock = util.NewFakeClock(now)
+	p.snapshotPath = path
+	p.snapshotMaxAge = time.Hour
+	if _, _, err := p.db.LookupRecords(context.Background(), "n1.pce.internal.", dns.TypeA); err == nil {
+		t.Fatal("database answered before the snapshot was loaded")
+	}
+	p.loadRecordSnapshot()
+
+	m := wireReply(t, p, "n1.pce.internal.")
+	if ips := addresses(m.Answer); len(ips) != 1 || ips[0] != "10.0.0.1" {
+		t.Fatalf("answered %v from the snapshot", ips)
+	}
+	if m.Authoritative {
+		t.Fatal("answer seeded from the snapshot is authoritative")
+	}
+	if text, ok := staleEDE(m); !ok || text != util.StaleSeeded {
+		t.Fatalf("Stale Answer EDE %q (present %t), expected %q", text, ok, util.StaleSeeded)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+// startupCheckTimeout bounds all startup checks together
+const startupCheckTimeout = 5 * time.Second
+
+// startupCheck is a lookup run against the plugin itself once setup completes
+type startupCheck struct {
+	name  string
+	qtype uint16
+}
+
+// lookup resolves a name through the same rewrite, zone, and adapter selection as ServeDNS
+func (p *PcePlugin) lookup(ctx context.Context, name string, qtype uint16) ([]util.Record, error) {
+	name = p.rewriteName(dns.CanonicalName(name))
+	zone := p.matchZone(name)
+	if zone == "" {
+		return nil, errNotAuthoritative
+	}
+	adapter, err := p.adapterFromZone(zone)
+	if err != nil {
+		return nil, err
+	}
+	records, _, err := adapter.LookupRecords(ctx, name, qtype)
+	return records, err
+}
+
+// runStartupChecks logs the result of every startup check. In strict mode, a check that
+// fails or returns no records is an error.
+func (p *PcePlugin) runStartupChecks() error {
+	if len(p.startupChecks) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupCheckTimeout)
+	defer cancel()
+
+	failed := 0
+	for _, check := range p.startupChecks {
+		qTypeStr := dns.TypeToString[check.qtype]
+		records, err := p.lookup(ctx, check.name, check.qtype)
+		switch {
+		case err != nil:
+			log.Log.Warningf("startup check: name=%q type=%s failed: %v", check.name, qTypeStr, err)
+			failed++
+		case len(records) == 0:
+			log.Log.Warningf("startup check: name=%q type=%s returned no records", check.name, qTypeStr)
+			failed++
+		default:
+			log.Log.Infof("startup check: name=%q type=%s returned %d record(s)", check.name, qTypeStr, len(records))
+		}
+	}
+
+	if failed > 0 && p.startupChecksStrict {
+		return fmt.Errorf("%d of %d startup check(s) failed", failed, len(p.startupChecks))
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+// decisionTrace accumulates the decisions taken for one query, logged as a single line
+// once the query is answered. The result is recorded for every query, the other decisions
+// only for traced ones.
+type decisionTrace struct {
+	// fields are the logged decisions, nil if the query is not traced
+	fields []string
+	// result is the outcome of the query, "" until decided
+	result string
+}
+
+// newTrace starts a trace for the query. Decisions are only logged if tracing is enabled
+// and the name matches the configured names (all names if none are configured).
+func (p *PcePlugin) newTrace(qName, qType string) *decisionTrace {
+	if !p.traceDecisions {
+		return &decisionTrace{}
+	}
+	if len(p.traceNames) > 0 && !traceMatches(p.traceNames, qName) {
+		return &decisionTrace{}
+	}
+	return &decisionTrace{fields: []string{"name=" + qName, "type=" + qType}}
+}
+
+func traceMatches(names []string, qName string) bool {
+	for _, name := range names {
+		if dns.IsSubDomain(name, qName) {
+			return true
+		}
+	}
+	return false
+}
+
+// add records a decision
+func (t *decisionTrace) add(key string, value any) {
+	if t.fields == nil {
+		return
+	}
+	t.fields = append(t.fields, fmt.Sprintf("%s=%v", key, value))
+}
+
+// setResult records the outcome of the query
+func (t *decisionTrace) setResult(result string) {
+	t.result = result
+	t.add("result", result)
+}
+
+// emit counts the query by result and logs the trace
+func (t *decisionTrace) emit(qType uint16) {
+	result := t.result
+	if result == "" {
+		// Returned without deciding, the client gave up
+		result = "aborted"
+	}
+	metrics.Requests.WithLabelValues(qtypeLabel(qType), result).Inc()
+	if t.fields == nil {
+		return
+	}
+	log.Log.Infof("trace: %s", strings.Join(t.fields, " "))
+}
+
+// countedQTypes are the query types counted under their own name, the others are
+// counted as "other" to bound the metric's cardinality
+var countedQTypes = map[uint16]struct{}{
+	dns.TypeA:     {},
+	dns.TypeAAAA:  {},
+	dns.TypeCNAME: {},
+	dns.TypeSRV:   {},
+	dns.TypeTXT:   {},
+	dns.TypePTR:   {},
+	dns.TypeSOA:   {},
+	dns.TypeNS:    {},
+	dns.TypeANY:   {},
+}
+
+func qtypeLabel(qType uint16) string {
+	if _, ok := countedQTypes[qType]; ok {
+		return dns.TypeToString[qType]
+	}
+	return "other"
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultWebhookTimeout bounds a single delivery attempt
+	defaultWebhookTimeout = 5 * time.Second
+	// defaultWebhookRetries is how many times a failed delivery is retried
+	defaultWebhookRetries = 3
+	// defaultWebhookBackoff is the delay before the first retry, doubled for each further one
+	defaultWebhookBackoff = time.Second
+	// defaultWebhookBatchSize bounds the number of records in one payload
+	defaultWebhookBatchSize = 500
+	// webhookQueueSize is how many record changes may wait for delivery before new ones
+	// are dropped
+	webhookQueueSize = 64
+)
+
+// webhookSender POSTs record changes to an external endpoint, e.g. to purge a cache.
+// Deliveries run in the background and never hold up DNS serving; failures are only
+// logged and counted.
+type webhookSender struct {
+	// url is the endpoint the changes are POSTed to
+	url string
+	// tokenFile holds the bearer token, re-read for every delivery so it can be rotated
+	// ("" for none)
+	tokenFile string
+	// timeout bounds a single delivery attempt
+	timeout time.Duration
+	// retries is how many times a failed delivery is retried
+	retries int
+	// backoff is the delay before the first retry
+	backoff time.Duration
+	// batchSize bounds the number of records in one payload
+	batchSize int
+
+	client *http.Client
+	queue  chan webhookPayload
+	stop   chan struct{}
+}
+
+// webhookPayload is one batch of the changes of a record set
+type webhookPayload struct {
+	Source     string          `json:"source"`
+	Generation uint64          `json:"generation"`
+	Batch      int             `json:"batch"`
+	Batches    int             `json:"batches"`
+	Added      []webhookRecord `json:"added"`
+	Removed    []webhookRecord `json:"removed"`
+	Changed    []webhookRecord `json:"changed"`
+}
+
+type webhookRecord struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	TTL  uint32 `json:"ttl"`
+	Data string `json:"data"`
+}
+
+func newWebhookSender(url string) *webhookSender {
+	return &webhookSender{
+		url:       url,
+		timeout:   defaultWebhookTimeout,
+		retries:   defaultWebhookRetries,
+		backoff:   defaultWebhookBackoff,
+		batchSize: defaultWebhookBatchSize,
+		client:    &http.Client{},
+		queue:     make(chan webhookPayload, webhookQueueSize),
+	}
+}
+
+// notify queues the changes for delivery, split into batches of at most batchSize
+// records. It never blocks: when the queue is full the changes are dropped.
+func (w *webhookSender) notify(source string, generation uint64, diff util.RecordDiff) {
+	payloads := w.batches(source, generation, diff)
+	for i, payload := range payloads {
+		select {
+		case w.queue <- payload:
+		default:
+			dropped := len(payloads) - i
+			log.Log.Warningf("webhook: queue full, dropping %d batch(es) of %s generation %d", dropped, source, generation)
+			metrics.WebhookDeliveries.WithLabelValues("dropped").Add(float64(dropped))
+			return
+		}
+	}
+}
+
+// batches splits the changes into payloads of at most batchSize records
+func (w *webhookSender) batches(source string, generation uint64, diff util.RecordDiff) []webhookPayload {
+	var payloads []webhookPayload
+	current := webhookPayload{Source: source, Generation: generation}
+	size := 0
+	for _, group := range []struct {
+		records []util.Record
+		dst     func(*webhookPayload) *[]webhookRecord
+	}{
+		{diff.Added, func(p *webhookPayload) *[]webhookRecord { return &p.Added }},
+		{diff.Removed, func(p *webhookPayload) *[]webhookRecord { return &p.Removed }},
+		{diff.Changed, func(p *webhookPayload) *[]webhookRecord { return &p.Changed }},
+	} {
+		for _, r := range group.records {
+			if size == w.batchSize {
+				payloads = append(payloads, current)
+				current = webhookPayload{Source: source, Generation: generation}
+				size = 0
+			}
+			dst := group.dst(&current)
+			*dst = append(*dst, webhookRecord{Name: r.FQDN, Type: dns.Type(r.Type).String(), TTL: r.TTL, Data: r.RData()})
+			size++
+		}
+	}
+	if size > 0 {
+		payloads = append(payloads, current)
+	}
+	for i := range payloads {
+		payloads[i].Batch = i + 1
+		payloads[i].Batches = len(payloads)
+	}
+	return payloads
+}
+
+// start delivers queued payloads in order until stop is closed
+func (w *webhookSender) start() {
+	w.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		for {
+			select {
+			case <-stop:
+				return
+			case payload := <-w.queue:
+				w.deliver(payload, stop)
+			}
+		}
+	}(w.stop)
+}
+
+// deliver POSTs a payload, retrying with exponential backoff
+func (w *webhookSender) deliver(payload webhookPayload, stop chan struct{}) {
+	body, err := json.Marshal(&payload)
+	if err != nil {
+		log.Log.Errorf("webhook: failed to encode payload: %v", err)
+		metrics.WebhookDeliveries.WithLabelValues("failure").Inc()
+		return
+	}
+
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		err = w.post(body)
+		if err == nil {
+			metrics.WebhookDeliveries.WithLabelValues("success").Inc()
+			return
+		}
+		if attempt == w.retries {
+			break
+		}
+		log.Log.Debugf("webhook: delivery of %s generation %d batch %d/%d failed, retrying in %s: %v", payload.Source, payload.Generation, payload.Batch, payload.Batches, backoff, err)
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	log.Log.Warningf("webhook: failed to deliver %s generation %d batch %d/%d: %v", payload.Source, payload.Generation, payload.Batch, payload.Batches, err)
+	metrics.WebhookDeliveries.WithLabelValues("failure").Inc()
+}
+
+// post makes a single delivery attempt
+func (w *webhookSender) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.tokenFile != "" {
+		token, err := os.ReadFile(w.tokenFile)
+		if err != nil {
+			return fmt.Errorf("reading token file: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// startWebhook subscribes the webhook to record changes of both sources. It must run
+// before the sources start.
+func (p *PcePlugin) startWebhook() {
+	if p.webhook == nil {
+		return
+	}
+	p.db.OnChange = p.webhook.notify
+	p.static.OnChange = p.webhook.notify
+	p.webhook.start()
+}
+
+// stopWebhook stops deliveries, dropping queued changes
+func (p *PcePlugin) stopWebhook() {
+	if p.webhook == nil || p.webhook.stop == nil {
+		return
+	}
+	close(p.webhook.stop)
+	p.webhook.stop = nil
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package static
+
+import (
+	"fmt"
+
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+)
+
+// instances holds the live plugin of each config, for adoption across reloads
+var instances util.InstanceRegistry[*Plugin]
+
+// configKey fingerprints the options that shape the record set. Plugins with the same key
+// parse the same records, so one may adopt the other's state.
+func (p *Plugin) configKey() string {
+	return fmt.Sprintf("%q %d %d %d %t %q %q", p.Path, p.TTL, p.MaxSize, p.MaxNodes, p.AliasCNAME, p.CollisionPolicy, p.Exclusion)
+}
+
+// adopt registers the plugin and takes over the parsed records of the plugin it replaces
+// on a reload, if that one had the same config. The file is then only parsed again once
+// it changes. Otherwise it starts cold.
+func (p *Plugin) adopt() {
+	p.registryKey = p.configKey()
+	prev, ok := instances.Replace(p.registryKey, p)
+	if !ok {
+		return
+	}
+
+	prev.mu.RLock()
+	records, generation, loadedAt := prev.records, prev.generation, prev.loadedAt
+	size, mtime := prev.cachedSize, prev.cachedMtime
+	prev.mu.RUnlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records, p.generation, p.loadedAt = records, generation, loadedAt
+	p.cachedSize, p.cachedMtime = size, mtime
+	ilog.Log.Infof("static: adopted %d record(s) at generation %d from the previous instance", len(records), generation)
+}
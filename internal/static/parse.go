@@ -17,10 +17,13 @@ package static
 
 import (
 	"encoding/json"
-	"net"
+	"fmt"
+	"io"
 	"os"
+	"time"
 
 	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
 	"github.com/PextraCloud/pce-coredns/internal/util"
 	"github.com/miekg/dns"
 )
@@ -28,25 +31,47 @@ import (
 type staticFile struct {
 	Version string `json:"version"`
 	// id -> IP address
-	Nodes            map[string]string `json:"nodes"`
+	Nodes map[string]string `json:"nodes"`
+	// alias -> node id
+	Aliases          map[string]string `json:"aliases"`
 	ClusterId        string            `json:"cluster_id"`
 	DatacenterId     string            `json:"datacenter_id"`
 	JoiningToCluster bool              `json:"joining_to_cluster"`
 }
 
 // parseStaticFile reads and parses the static config file, returning the list of records.
-func parseStaticFile(file *os.File, ttl uint32) ([]util.Record, error) {
-	decoder := json.NewDecoder(file)
+// Aliases are served as copies of their node's records, or as CNAMEs if aliasCNAME is set.
+func parseStaticFile(r io.Reader, ttl uint32, policy util.CollisionPolicy, maxNodes int, aliasCNAME bool) ([]util.Record, error) {
+	decoder := json.NewDecoder(r)
 	var config staticFile
 	if err := decoder.Decode(&config); err != nil {
 		return nil, err
 	}
+	if maxNodes > 0 && len(config.Nodes) > maxNodes {
+		return nil, fmt.Errorf("file lists %d nodes, more than the limit of %d", len(config.Nodes), maxNodes)
+	}
 
-	records := make([]util.Record, 0, len(config.Nodes))
+	// Node ids are canonicalized (lowercased) into FQDNs, so ids differing only by case collide
+	records := make([]util.OwnedRecord, 0, len(config.Nodes)+len(config.Aliases))
+	// node id -> record, for aliases
+	nodeRecords := make(map[string]util.Record, len(config.Nodes))
 	for nodeId, ipStr := range config.Nodes {
-		ip := net.ParseIP(ipStr)
-		if ip == nil {
-			ilog.Log.Warningf("static: skipping node %q with invalid IP %q", nodeId, ipStr)
+		ip, err := util.ParseAddress(ipStr)
+		if err != nil {
+			ilog.Log.Warningf("static: skipping node %q, its address %q %v", nodeId, ipStr, err)
+			continue
+		}
+
+		if err := util.CheckLabel(nodeId); err != nil {
+			ilog.Log.Warningf("static: rejecting node %q: node id %v", nodeId, err)
+			metrics.InvalidNames.WithLabelValues(util.SourceStatic).Inc()
+			continue
+		}
+		fqdn := dns.CanonicalName(nodeId + "." + util.ZoneBootstrap)
+		if _, ok := dns.IsDomainName(fqdn); !ok {
+			// Over 255 octets, a label over 63 octets, or an empty label
+			ilog.Log.Warningf("static: skipping node %q with invalid name %q", nodeId, fqdn)
+			metrics.InvalidNames.WithLabelValues(util.SourceStatic).Inc()
 			continue
 		}
 
@@ -57,19 +82,94 @@ func parseStaticFile(file *os.File, ttl uint32) ([]util.Record, error) {
 			recType = dns.TypeAAAA
 		}
 		record := util.Record{
-			FQDN: dns.CanonicalName(nodeId + "." + util.ZoneBootstrap),
+			FQDN: fqdn,
 			Type: recType,
 			TTL:  ttl,
 			Content: util.RecordContent{
 				IP: ip,
 			},
+			Source: util.SourceStatic,
+		}
+		records = append(records, util.OwnedRecord{Record: record, Owner: nodeId})
+		nodeRecords[nodeId] = record
+	}
+	records = append(records, aliasRecords(config.Aliases, nodeRecords, ttl, aliasCNAME)...)
+	resolved := util.ResolveCollisions(util.SourceStatic, records, policy)
+	return util.EnforceCNAMEExclusivity(util.SourceStatic, resolved), nil
+}
+
+// aliasRecords builds the records of each alias from the record of the node it refers to.
+// Aliases naming an unknown node or shadowing a node id are skipped.
+func aliasRecords(aliases map[string]string, nodeRecords map[string]util.Record, ttl uint32, asCNAME bool) []util.OwnedRecord {
+	nodeNames := make(map[string]struct{}, len(nodeRecords))
+	for _, record := range nodeRecords {
+		nodeNames[record.FQDN] = struct{}{}
+	}
+
+	records := make([]util.OwnedRecord, 0, len(aliases))
+	for alias, nodeId := range aliases {
+		target, ok := nodeRecords[nodeId]
+		if !ok {
+			ilog.Log.Warningf("static: skipping alias %q for unknown node %q", alias, nodeId)
+			continue
+		}
+		if err := util.CheckLabel(alias); err != nil {
+			ilog.Log.Warningf("static: rejecting alias %q of node %q: alias %v", alias, nodeId, err)
+			metrics.InvalidNames.WithLabelValues(util.SourceStatic).Inc()
+			continue
+		}
+		fqdn := dns.CanonicalName(alias + "." + util.ZoneBootstrap)
+		if _, ok := dns.IsDomainName(fqdn); !ok {
+			ilog.Log.Warningf("static: skipping alias %q with invalid name %q", alias, fqdn)
+			metrics.InvalidNames.WithLabelValues(util.SourceStatic).Inc()
+			continue
+		}
+		if _, shadows := nodeNames[fqdn]; shadows {
+			ilog.Log.Warningf("static: skipping alias %q, it collides with a node id", alias)
+			continue
+		}
+
+		record := target
+		record.FQDN = fqdn
+		if asCNAME {
+			record.Type = dns.TypeCNAME
+			record.TTL = ttl
+			record.Content = util.RecordContent{CNAME: target.FQDN}
 		}
-		records = append(records, record)
+		records = append(records, util.OwnedRecord{Record: record, Owner: nodeId})
 	}
-	return records, nil
+	return records
+}
+
+// ForceReload re-reads the static file even if its size and modification time are unchanged
+func (p *Plugin) ForceReload() {
+	p.mu.Lock()
+	p.cachedSize = -1
+	p.cachedMtime = time.Time{}
+	p.mu.Unlock()
+
+	p.ReadStatic()
 }
 
 func (p *Plugin) ReadStatic() {
+	if p.paused.Load() {
+		return
+	}
+	// Check the file before opening it: opening a FIFO would block until a writer shows up
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		ilog.Log.Debugf("static: failed to stat file %s: %v", p.Path, err)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		ilog.Log.Errorf("static: %s is not a regular file (%s), keeping previous records", p.Path, info.Mode().Type())
+		return
+	}
+	if p.MaxSize > 0 && info.Size() > p.MaxSize {
+		ilog.Log.Errorf("static: %s is %d bytes, over the limit of %d, keeping previous records", p.Path, info.Size(), p.MaxSize)
+		return
+	}
+
 	file, err := os.Open(p.Path)
 	if err != nil {
 		ilog.Log.Debugf("static: failed to open file %s: %v", p.Path, err)
@@ -91,17 +191,42 @@ func (p *Plugin) ReadStatic() {
 		return
 	}
 
-	records, err := parseStaticFile(file, p.TTL)
+	// The file may have grown since it was checked
+	var r io.Reader = file
+	if p.MaxSize > 0 {
+		r = io.LimitReader(file, p.MaxSize)
+	}
+	records, err := parseStaticFile(r, p.TTL, p.CollisionPolicy, p.MaxNodes, p.AliasCNAME)
 	if err != nil {
 		ilog.Log.Errorf("static: failed to parse file %s: %v", p.Path, err)
 		return
 	}
+	records = p.Exclusion.Apply(util.SourceStatic, records)
 
 	p.mu.Lock()
-	p.records = records
+	// A rewrite with identical content is not a new snapshot
+	diff := util.DiffRecords(p.records, records)
+	changed := p.generation == 0 || !diff.Empty()
+	if changed {
+		if p.generation > 0 {
+			diff.Log(util.SourceStatic)
+		}
+		p.records = records
+		p.generation++
+		p.loadedAt = p.Clock.Now()
+		metrics.SnapshotGeneration.WithLabelValues(util.SourceStatic).Set(float64(p.generation))
+		if p.generation > 1 && p.OnChange != nil {
+			p.OnChange(util.SourceStatic, p.generation, diff)
+		}
+	}
 	p.cachedSize = stat.Size()
 	p.cachedMtime = stat.ModTime()
 	p.mu.Unlock()
 
+	if !changed {
+		ilog.Log.Debugf("static: %s rewritten without record changes", p.Path)
+		return
+	}
+	util.ReportRecordSet(util.SourceStatic, records, p.SoftLimit)
 	ilog.Log.Infof("static: refreshed %d record(s) from %s", len(records), p.Path)
 }
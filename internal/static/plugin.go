@@ -17,12 +17,14 @@ package static
 
 import (
 	"context"
+	"errors"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	ilog "github.com/PextraCloud/pce-coredns/internal/log"
 	"github.com/PextraCloud/pce-coredns/internal/util"
-	"github.com/miekg/dns"
 )
 
 type Plugin struct {
@@ -32,6 +34,25 @@ type Plugin struct {
 	Path string
 	// TTL is the TTL to set on returned records
 	TTL uint32
+	// MaxSize is the largest static file in bytes that will be parsed (0 for no limit)
+	MaxSize int64
+	// MaxNodes is the largest number of nodes accepted from the static file (0 for no limit)
+	MaxNodes int
+	// SoftLimit is the record set size in bytes above which a warning is logged (0 for none)
+	SoftLimit int64
+	// AliasCNAME serves node aliases as CNAMEs to the node's name instead of address records
+	AliasCNAME bool
+	// Exclusion keeps addresses within excluded prefixes out of the records (nil for none)
+	Exclusion *util.AddressExclusion
+	// CollisionPolicy decides what is served when node ids differ only by case
+	CollisionPolicy util.CollisionPolicy
+	// Clock is the source of time for the refresh loop
+	Clock util.Clock
+	// Scheduler runs the periodic refresh. If nil, Start creates a private one.
+	Scheduler *util.Scheduler
+	// OnChange is notified when a refresh changes the records (nil for none). It must be
+	// set before Start.
+	OnChange util.ChangeFunc
 
 	mu sync.RWMutex
 	// cachedSize is the size of the cached file (change detection)
@@ -41,95 +62,181 @@ type Plugin struct {
 
 	// records is the in-memory cache of static records
 	records []util.Record
-
-	// loop is used to signal the background goroutine to stop
-	loop *chan struct{}
+	// generation is incremented every time records is replaced
+	generation uint64
+	// loadedAt is when records was last replaced
+	loadedAt time.Time
+
+	// lifecycleMu guards stopRefresh, ownScheduler and closed, so Start and Close may
+	// interleave safely
+	lifecycleMu sync.Mutex
+	// stopRefresh cancels the periodic refresh job
+	stopRefresh func()
+	// ownScheduler is set when Start had to create the scheduler, and Close stops it
+	ownScheduler bool
+	// closed is set once Close has been called; a closed plugin cannot be restarted
+	closed bool
+	// registryKey is the key the plugin is registered under for adoption on reload
+	registryKey string
+	// paused skips reading the static file, keeping the current records
+	paused atomic.Bool
 }
 
+// ErrClosed is returned when starting a plugin that has been closed
+var ErrClosed = errors.New("static: plugin is closed")
+
 func NewPlugin() *Plugin {
 	return &Plugin{
 		Interval: 5 * time.Second,
 		TTL:      10,
 		Path:     "/var/lib/pce/crdb-locality",
+		MaxSize:  4 << 20,
+		MaxNodes: 10000,
+
+		CollisionPolicy: util.CollisionMerge,
+		Clock:           util.RealClock,
 	}
 }
 
-// comp-time check: Plugin implements util.Adapter
+// comp-time check: Plugin implements util.Adapter, util.AddressAdapter, util.ReverseAdapter
+// and util.Generational
 var _ util.Adapter = (*Plugin)(nil)
-
-func (p *Plugin) Start() {
-	if p.loop != nil {
+var _ util.AddressAdapter = (*Plugin)(nil)
+var _ util.ReverseAdapter = (*Plugin)(nil)
+var _ util.Generational = (*Plugin)(nil)
+
+func (p *Plugin) Start() error {
+	p.lifecycleMu.Lock()
+	if p.closed {
+		p.lifecycleMu.Unlock()
+		return ErrClosed
+	}
+	if p.stopRefresh != nil {
 		// Already started
-		return
+		p.lifecycleMu.Unlock()
+		return nil
 	}
 
 	if p.Path == "" {
+		p.lifecycleMu.Unlock()
 		ilog.Log.Errorf("static: no path to static config file provided")
-		return
+		return nil
 	}
 	if p.TTL == 0 {
 		ilog.Log.Warningf("static: TTL of 0 provided, defaulting to 10 seconds")
 		p.TTL = 10
 	}
+	p.adopt()
 	if p.Interval <= 0 {
+		p.lifecycleMu.Unlock()
 		ilog.Log.Warningf("static: invalid refresh interval, skipping periodic reload")
 		// Run once
 		p.ReadStatic()
-		return
+		return nil
 	}
 
-	ticker := time.NewTicker(p.Interval)
-	loop := make(chan struct{})
-	p.loop = &loop
-
-	go func() {
-		for {
-			select {
-			// Periodic update
-			case <-ticker.C:
-				p.ReadStatic()
-			// Shutdown signal
-			case <-loop:
-				ticker.Stop()
-				return
-			}
-		}
-	}()
+	if p.Scheduler == nil {
+		p.Scheduler = util.NewScheduler(p.Clock, 1)
+		p.ownScheduler = true
+	}
+	p.stopRefresh = p.Scheduler.Every("static_refresh", p.Interval, util.DefaultSchedulerJitter, func() error {
+		p.ReadStatic()
+		return nil
+	})
+	p.lifecycleMu.Unlock()
 
 	// Run immediately
 	p.ReadStatic()
+	return nil
 }
 
+// Close stops the background refresh. It is safe to call more than once.
 func (p *Plugin) Close() error {
-	if p.loop != nil {
-		close(*p.loop)
-		p.loop = nil
+	p.lifecycleMu.Lock()
+	defer p.lifecycleMu.Unlock()
+
+	p.closed = true
+	instances.Remove(p.registryKey, p)
+	if p.stopRefresh != nil {
+		p.stopRefresh()
+		p.stopRefresh = nil
+	}
+	if p.ownScheduler {
+		p.Scheduler.Stop()
+		p.ownScheduler = false
 	}
 	return nil
 }
 
-func (p *Plugin) LookupRecords(ctx context.Context, name string, qtype uint16) ([]util.Record, bool, error) {
-	var results []util.Record
-	nameExists := false
+func (p *Plugin) Generation() uint64 {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
+	return p.generation
+}
+
+// SnapshotAt returns when the current record set generation was produced
+func (p *Plugin) SnapshotAt() time.Time {
+	return p.LoadedAt()
+}
 
-	nameFqdn := dns.CanonicalName(name)
-	// Find matches based on FQDN and query type
-	for _, record := range p.records {
-		if dns.CanonicalName(record.FQDN) != nameFqdn {
-			continue
-		}
-		nameExists = true
-
-		if qtype == dns.TypeANY || record.Type == qtype {
-			// Match type if not ANY
-			results = append(results, record)
-		} else if (qtype == dns.TypeA || qtype == dns.TypeAAAA) && record.Type == dns.TypeCNAME {
-			// Special case: include CNAME records when querying A/AAAA
-			results = append(results, record)
-		}
+// LoadedAt returns when the current records were read from the static file
+func (p *Plugin) LoadedAt() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.loadedAt
+}
+
+// Snapshot returns the current record set and its generation. The records must not be
+// modified.
+func (p *Plugin) Snapshot() (uint64, []util.Record) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.generation, p.records
+}
+
+// SetPaused stops or resumes reading the static file
+func (p *Plugin) SetPaused(paused bool) {
+	p.paused.Store(paused)
+}
+
+// Seed serves records until the static file is first read, e.g. from a snapshot when the
+// file is gone
+func (p *Plugin) Seed(records []util.Record) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.generation > 0 {
+		return
 	}
+	p.records = records
+	ilog.Log.Warningf("static: serving %d seeded record(s) until the static file is read", len(records))
+}
+
+// Stale reports whether the seeded records are served, before the static file was read
+func (p *Plugin) Stale() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.generation == 0 && len(p.records) > 0 {
+		return util.StaleSeeded
+	}
+	return ""
+}
+
+func (p *Plugin) LookupRecords(ctx context.Context, name string, qtype uint16) ([]util.Record, bool, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
+	results, nameExists := util.MatchRecords(p.records, name, qtype)
 	return results, nameExists, nil
 }
+
+func (p *Plugin) LookupAddresses(ctx context.Context, names []string) ([]util.Record, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return util.FilterAddresses(p.records, names), nil
+}
+
+func (p *Plugin) LookupReverse(ctx context.Context, ip net.IP) ([]util.Record, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return util.FilterByIP(p.records, ip), nil
+}
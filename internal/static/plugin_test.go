@@ -0,0 +1,134 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package static
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/util"
+)
+
+func newTestPlugin(t *testing.T) *Plugin {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "static.json")
+	if err := os.WriteFile(path, []byte(`{"nodes":{"n1":"10.0.0.1"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := NewPlugin()
+	p.Path = path
+	p.Clock = util.NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	return p
+}
+
+// TestStartCloseConcurrent interleaves Start and Close the way overlapping reloads do. Run
+// with -race.
+func TestStartCloseConcurrent(t *testing.T) {
+	for range 50 {
+		p := newTestPlugin(t)
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if err := p.Start(); err != nil && !errors.Is(err, ErrClosed) {
+					t.Errorf("unexpected Start error: %v", err)
+				}
+				_ = p.Generation()
+			}()
+			go func() {
+				defer wg.Done()
+				_ = p.Close()
+			}()
+		}
+		wg.Wait()
+
+		if err := p.Start(); !errors.Is(err, ErrClosed) {
+			t.Fatalf("Start after Close returned %v, expected ErrClosed", err)
+		}
+		p.lifecycleMu.Lock()
+		running, owned := p.stopRefresh != nil, p.ownScheduler
+		p.lifecycleMu.Unlock()
+		if running || owned {
+			t.Fatalf("refresh still scheduled after Close (job=%t, scheduler=%t)", running, owned)
+		}
+	}
+}
+
+func TestStartIdempotent(t *testing.T) {
+	p := newTestPlugin(t)
+	defer p.Close()
+	for range 3 {
+		if err := p.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gen := p.Generation(); gen != 1 {
+		t.Fatalf("expected the file to be read once, got generation %d", gen)
+	}
+	// A single refresh job waits on the clock
+	clock := p.Clock.(*util.FakeClock)
+	clock.BlockUntil(1)
+	time.Sleep(5 * time.Millisecond)
+	if n := clock.Waiters(); n != 1 {
+		t.Fatalf("expected one refresh job, got %d", n)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("second Close failed: %v", err)
+	}
+}
+
+// TestForceReloadAfterAdopt rewrites the file keeping its size and mtime across a reload,
+// which only a forced read picks up
+func TestForceReloadAfterAdopt(t *testing.T) {
+	prev := newTestPlugin(t)
+	prev.Interval = 0
+	if err := prev.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer prev.Close()
+	info, err := os.Stat(prev.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(prev.Path, []byte(`{"nodes":{"n1":"10.0.0.2"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(prev.Path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPlugin()
+	p.Path, p.Interval, p.Clock = prev.Path, 0, prev.Clock
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if _, records := p.Snapshot(); len(records) != 1 || records[0].Content.IP.String() != "10.0.0.1" {
+		t.Fatalf("expected the adopted records, got %v", records)
+	}
+	p.ForceReload()
+	if _, records := p.Snapshot(); len(records) != 1 || records[0].Content.IP.String() != "10.0.0.2" {
+		t.Fatalf("forced reload missed the rewrite, got %v", records)
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// ParseAddress parses an IP address written by hand. Surrounding whitespace and the
+// brackets of IPv6 literals are stripped, but zone indices and ports are rejected with an
+// error saying so, since they cannot be served in an address record.
+func ParseAddress(value string) (net.IP, error) {
+	value = strings.TrimSpace(value)
+	if ip := net.ParseIP(value); ip != nil {
+		return ip, nil
+	}
+
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		if net.ParseIP(stripZone(host)) != nil {
+			return nil, errors.New("has a port")
+		}
+	}
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		value = value[1 : len(value)-1]
+		if ip := net.ParseIP(value); ip != nil && ip.To4() == nil {
+			return ip, nil
+		}
+	}
+	if stripped := stripZone(value); stripped != value && net.ParseIP(stripped) != nil {
+		return nil, errors.New("has a zone index")
+	}
+	return nil, errors.New("is not an IP address")
+}
+
+// stripZone drops the zone index of an IPv6 address
+func stripZone(value string) string {
+	if i := strings.IndexByte(value, '%'); i >= 0 {
+		return value[:i]
+	}
+	return value
+}
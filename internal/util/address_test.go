@@ -0,0 +1,68 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		value string
+		// expected is the parsed address, "" when an error is expected
+		expected string
+		err      string
+	}{
+		{value: "10.0.0.1", expected: "10.0.0.1"},
+		{value: " 10.0.0.1\t", expected: "10.0.0.1"},
+		{value: "fd00::1", expected: "fd00::1"},
+		{value: "FD00::1", expected: "fd00::1"},
+		{value: "[fd00::1]", expected: "fd00::1"},
+		{value: " [fd00::1] ", expected: "fd00::1"},
+		{value: "::ffff:10.0.0.1", expected: "10.0.0.1"},
+		{value: "10.0.0.1:53", err: "has a port"},
+		{value: "[fd00::1]:53", err: "has a port"},
+		{value: "[fe80::1%eth0]:53", err: "has a port"},
+		{value: "fe80::1%eth0", err: "has a zone index"},
+		{value: "[fe80::1%eth0]", err: "has a zone index"},
+		// Only IPv6 literals are bracketed
+		{value: "[10.0.0.1]", err: "is not an IP address"},
+		{value: "[fd00::1", err: "is not an IP address"},
+		{value: "", err: "is not an IP address"},
+		{value: "node1", err: "is not an IP address"},
+		{value: "10.0.0.256", err: "is not an IP address"},
+		{value: "10.0.0.0/8", err: "is not an IP address"},
+		{value: "fd00::1/64", err: "is not an IP address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			ip, err := ParseAddress(tt.value)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got %v, %v, expected error %q", ip, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ip.Equal(net.ParseIP(tt.expected)) {
+				t.Fatalf("parsed %s, expected %s", ip, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+// EnforceCNAMEExclusivity drops every other record at an owner that has a CNAME, since a
+// CNAME cannot coexist with other data (RFC 1034 3.6.2). Offending owners are logged and
+// counted.
+func EnforceCNAMEExclusivity(source string, records []Record) []Record {
+	cnames := map[string]struct{}{}
+	for _, r := range records {
+		if r.Type == dns.TypeCNAME {
+			cnames[r.FQDN] = struct{}{}
+		}
+	}
+	if len(cnames) == 0 {
+		return records
+	}
+
+	results := make([]Record, 0, len(records))
+	conflicts := map[string]struct{}{}
+	for _, r := range records {
+		if _, ok := cnames[r.FQDN]; ok && r.Type != dns.TypeCNAME {
+			conflicts[r.FQDN] = struct{}{}
+			continue
+		}
+		results = append(results, r)
+	}
+	for fqdn := range conflicts {
+		ilog.Log.Warningf("%s: %s has a CNAME and other records, serving only the CNAME", source, fqdn)
+		metrics.CNAMEConflicts.WithLabelValues(source).Inc()
+	}
+	return results
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"fmt"
+	"slices"
+
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+)
+
+// CollisionPolicy decides what is served when distinct owners produce the same name
+type CollisionPolicy string
+
+const (
+	// CollisionFirst serves only the records of the first owner (by id)
+	CollisionFirst CollisionPolicy = "first"
+	// CollisionMerge serves the records of all owners
+	CollisionMerge CollisionPolicy = "merge"
+	// CollisionDrop serves nothing for the colliding name
+	CollisionDrop CollisionPolicy = "drop"
+)
+
+func ParseCollisionPolicy(s string) (CollisionPolicy, error) {
+	switch p := CollisionPolicy(s); p {
+	case CollisionFirst, CollisionMerge, CollisionDrop:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown collision policy '%s'", s)
+	}
+}
+
+// OwnedRecord is a record along with the id of the node that produced it. Records
+// with an empty Owner are shared by design (e.g. SRV) and never collide.
+type OwnedRecord struct {
+	Record
+	Owner string
+}
+
+// ResolveCollisions warns about and counts names produced by more than one owner, then
+// applies the policy to them.
+func ResolveCollisions(source string, records []OwnedRecord, policy CollisionPolicy) []Record {
+	// FQDN -> sorted owners
+	owners := map[string][]string{}
+	for _, r := range records {
+		if r.Owner == "" {
+			continue
+		}
+		fqdn := r.FQDN
+		if !slices.Contains(owners[fqdn], r.Owner) {
+			owners[fqdn] = append(owners[fqdn], r.Owner)
+		}
+	}
+	for fqdn, ids := range owners {
+		if len(ids) < 2 {
+			delete(owners, fqdn)
+			continue
+		}
+		slices.Sort(ids)
+		ilog.Log.Warningf("%s: name %s is produced by multiple owners %q, applying collision policy %q", source, fqdn, ids, policy)
+		metrics.NameCollisions.WithLabelValues(source).Inc()
+	}
+
+	results := make([]Record, 0, len(records))
+	for _, r := range records {
+		ids, collides := owners[r.FQDN]
+		if collides && r.Owner != "" {
+			if policy == CollisionDrop || (policy == CollisionFirst && r.Owner != ids[0]) {
+				continue
+			}
+		}
+		results = append(results, r.Record)
+	}
+	return results
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func owned(fqdn, ip, owner string) OwnedRecord {
+	return OwnedRecord{
+		Record: Record{FQDN: fqdn, Type: dns.TypeA, TTL: 60, Content: RecordContent{IP: net.ParseIP(ip)}},
+		Owner:  owner,
+	}
+}
+
+func TestResolveCollisions(t *testing.T) {
+	// Two owners of a.pce.internal. (listed out of id order), three of b.pce.internal.,
+	// one of c.pce.internal. and a shared SRV-like name that no owner claims
+	records := []OwnedRecord{
+		owned("a.pce.internal.", "10.0.0.2", "node-2"),
+		owned("a.pce.internal.", "10.0.0.1", "node-1"),
+		owned("b.pce.internal.", "10.0.1.3", "node-3"),
+		owned("b.pce.internal.", "10.0.1.1", "node-1"),
+		owned("b.pce.internal.", "10.0.1.2", "node-2"),
+		owned("b.pce.internal.", "10.0.1.4", "node-1"),
+		owned("c.pce.internal.", "10.0.2.1", "node-1"),
+		owned("c.pce.internal.", "10.0.2.2", "node-1"),
+		owned("shared.pce.internal.", "10.0.3.1", ""),
+		owned("shared.pce.internal.", "10.0.3.2", ""),
+		// Shared records under a colliding name are kept whatever the policy
+		owned("a.pce.internal.", "10.0.0.9", ""),
+	}
+	tests := []struct {
+		policy   CollisionPolicy
+		expected []string
+	}{
+		{
+			policy: CollisionFirst,
+			expected: []string{
+				"a.pce.internal. 10.0.0.1",
+				"b.pce.internal. 10.0.1.1",
+				"b.pce.internal. 10.0.1.4",
+				"c.pce.internal. 10.0.2.1",
+				"c.pce.internal. 10.0.2.2",
+				"shared.pce.internal. 10.0.3.1",
+				"shared.pce.internal. 10.0.3.2",
+				"a.pce.internal. 10.0.0.9",
+			},
+		},
+		{
+			policy: CollisionMerge,
+			expected: []string{
+				"a.pce.internal. 10.0.0.2",
+				"a.pce.internal. 10.0.0.1",
+				"b.pce.internal. 10.0.1.3",
+				"b.pce.internal. 10.0.1.1",
+				"b.pce.internal. 10.0.1.2",
+				"b.pce.internal. 10.0.1.4",
+				"c.pce.internal. 10.0.2.1",
+				"c.pce.internal. 10.0.2.2",
+				"shared.pce.internal. 10.0.3.1",
+				"shared.pce.internal. 10.0.3.2",
+				"a.pce.internal. 10.0.0.9",
+			},
+		},
+		{
+			policy: CollisionDrop,
+			expected: []string{
+				"c.pce.internal. 10.0.2.1",
+				"c.pce.internal. 10.0.2.2",
+				"shared.pce.internal. 10.0.3.1",
+				"shared.pce.internal. 10.0.3.2",
+				"a.pce.internal. 10.0.0.9",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			source := "test_" + string(tt.policy)
+			results := ResolveCollisions(source, records, tt.policy)
+			got := make([]string, 0, len(results))
+			for _, r := range results {
+				got = append(got, r.FQDN+" "+r.Content.IP.String())
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("got %q, expected %q", got, tt.expected)
+			}
+			// a. and b. collide; c. has one owner and shared. has none
+			if n := testutil.ToFloat64(metrics.NameCollisions.WithLabelValues(source)); n != 2 {
+				t.Errorf("counted %v collisions, expected 2", n)
+			}
+		})
+	}
+}
+
+func TestParseCollisionPolicy(t *testing.T) {
+	for _, s := range []string{"first", "merge", "drop"} {
+		if p, err := ParseCollisionPolicy(s); err != nil || string(p) != s {
+			t.Errorf("ParseCollisionPolicy(%q) = %q, %v", s, p, err)
+		}
+	}
+	if _, err := ParseCollisionPolicy("last"); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"fmt"
+
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+// maxDiffLogLines bounds the number of change lines logged per refresh
+const maxDiffLogLines = 20
+
+// recordKey identifies a record by owner, type, and rdata
+type recordKey struct {
+	fqdn  string
+	rtype uint16
+	rdata string
+}
+
+// RData renders the type-specific content of the record in presentation format
+func (r *Record) RData() string {
+	if r.Content.RFC3597 != "" {
+		return r.Content.RFC3597
+	}
+	switch r.Type {
+	case dns.TypeA, dns.TypeAAAA:
+		return r.Content.IP.String()
+	case dns.TypeCNAME:
+		return dns.CanonicalName(r.Content.CNAME)
+	case dns.TypeSRV:
+		return fmt.Sprintf("%d %d %d %s", r.Content.Priority, r.Content.Weight, r.Content.Port, dns.CanonicalName(r.Content.Target))
+	case dns.TypeTXT:
+		return r.Content.Data
+	case dns.TypeNS, dns.TypePTR:
+		return dns.CanonicalName(r.Content.Target)
+	case dns.TypeSOA:
+		if soa := r.Content.SOA; soa != nil {
+			return fmt.Sprintf("%s %s %d %d %d %d %d", dns.CanonicalName(soa.Mname), dns.CanonicalName(soa.Rname), soa.Serial, soa.Refresh, soa.Retry, soa.Expire, soa.Minttl)
+		}
+		return ""
+	default:
+		return ""
+	}
+}
+
+func (r *Record) key() recordKey {
+	return recordKey{fqdn: r.FQDN, rtype: r.Type, rdata: r.RData()}
+}
+
+func (r *Record) String() string {
+	return fmt.Sprintf("%s %d %s %s", r.FQDN, r.TTL, dns.Type(r.Type).String(), r.RData())
+}
+
+// RecordDiff is the difference between two record sets
+type RecordDiff struct {
+	Added   []Record
+	Removed []Record
+	// Changed holds the new version of records whose TTL changed
+	Changed []Record
+}
+
+func (d *RecordDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// ChangeFunc is notified of the differences each time a source replaces its record set
+// after the first load. It is called with the source's locks held and must not block.
+type ChangeFunc func(source string, generation uint64, diff RecordDiff)
+
+// DiffRecords compares two record sets, ignoring ordering
+func DiffRecords(prev, next []Record) RecordDiff {
+	prevByKey := make(map[recordKey]Record, len(prev))
+	for _, r := range prev {
+		prevByKey[r.key()] = r
+	}
+
+	var diff RecordDiff
+	seen := make(map[recordKey]struct{}, len(next))
+	for _, r := range next {
+		k := r.key()
+		seen[k] = struct{}{}
+		old, ok := prevByKey[k]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, r)
+		case old.TTL != r.TTL:
+			diff.Changed = append(diff.Changed, r)
+		}
+	}
+	for k, r := range prevByKey {
+		if _, ok := seen[k]; !ok {
+			diff.Removed = append(diff.Removed, r)
+		}
+	}
+	return diff
+}
+
+// Log logs and counts the changes of a record set loaded from source
+func (d *RecordDiff) Log(source string) {
+	if d.Empty() {
+		return
+	}
+
+	metrics.RecordChanges.WithLabelValues(source, "added").Add(float64(len(d.Added)))
+	metrics.RecordChanges.WithLabelValues(source, "removed").Add(float64(len(d.Removed)))
+	metrics.RecordChanges.WithLabelValues(source, "changed").Add(float64(len(d.Changed)))
+	ilog.Log.Infof("%s: records changed: %d added, %d removed, %d changed", source, len(d.Added), len(d.Removed), len(d.Changed))
+
+	logged := 0
+	for _, group := range []struct {
+		change  string
+		records []Record
+	}{
+		{"added", d.Added},
+		{"removed", d.Removed},
+		{"changed", d.Changed},
+	} {
+		for _, r := range group.records {
+			if logged == maxDiffLogLines {
+				ilog.Log.Infof("%s: further record changes not logged", source)
+				return
+			}
+			ilog.Log.Infof("%s: record %s: %s", source, group.change, r.String())
+			logged++
+		}
+	}
+}
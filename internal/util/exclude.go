@@ -0,0 +1,139 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+// AddressExclusion keeps addresses within excluded prefixes out of the record sets, e.g.
+// provisioning networks that must never be handed out. Matching address records are
+// dropped, or rewritten to the substitute address of their family if one is set. A nil
+// AddressExclusion excludes nothing.
+type AddressExclusion struct {
+	// Prefixes are the excluded networks
+	Prefixes []*net.IPNet
+	// Substitute4 and Substitute6 replace excluded IPv4 and IPv6 addresses (nil drops them)
+	Substitute4 net.IP
+	Substitute6 net.IP
+
+	mu sync.Mutex
+	// excluded holds the records excluded by the last load of each source
+	excluded map[string][]Record
+}
+
+// Apply returns records without the excluded addresses. Names left without records by the
+// exclusions disappear from the record set, which is intended.
+func (e *AddressExclusion) Apply(source string, records []Record) []Record {
+	if e == nil || len(e.Prefixes) == 0 {
+		return records
+	}
+
+	results := make([]Record, 0, len(records))
+	var excluded []Record
+	substituted := map[string]struct{}{}
+	for _, r := range records {
+		if (r.Type != dns.TypeA && r.Type != dns.TypeAAAA) || !e.Excludes(r.Content.IP) {
+			results = append(results, r)
+			continue
+		}
+		excluded = append(excluded, r)
+
+		substitute := e.Substitute6
+		if r.Type == dns.TypeA {
+			substitute = e.Substitute4
+		}
+		if substitute == nil {
+			metrics.ExcludedAddresses.WithLabelValues(source, "dropped").Inc()
+			continue
+		}
+		metrics.ExcludedAddresses.WithLabelValues(source, "substituted").Inc()
+		// Several excluded addresses of a name collapse into one substitute
+		key := r.FQDN + " " + dns.Type(r.Type).String()
+		if _, dup := substituted[key]; dup {
+			continue
+		}
+		substituted[key] = struct{}{}
+		r.Content = RecordContent{IP: substitute}
+		results = append(results, r)
+	}
+	e.remember(source, excluded)
+	return results
+}
+
+// Excludes reports whether ip is within an excluded prefix
+func (e *AddressExclusion) Excludes(ip net.IP) bool {
+	for _, prefix := range e.Prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remember stores the records excluded from a source, warning when they change
+func (e *AddressExclusion) remember(source string, excluded []Record) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.excluded == nil {
+		e.excluded = map[string][]Record{}
+	}
+	previous := e.excluded[source]
+	e.excluded[source] = excluded
+	diff := DiffRecords(previous, excluded)
+	if !diff.Empty() && len(excluded) > 0 {
+		ilog.Log.Warningf("%s: excluding %d address record(s) within excluded prefixes", source, len(excluded))
+	}
+}
+
+// Excluded returns the records named name that the last loads excluded, for debugging
+func (e *AddressExclusion) Excluded(name string) []Record {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var results []Record
+	for _, source := range slices.Sorted(maps.Keys(e.excluded)) {
+		for _, r := range e.excluded[source] {
+			if r.FQDN == name {
+				results = append(results, r)
+			}
+		}
+	}
+	return results
+}
+
+// String describes the exclusion, e.g. to tell configurations apart
+func (e *AddressExclusion) String() string {
+	if e == nil {
+		return ""
+	}
+	prefixes := make([]string, 0, len(e.Prefixes))
+	for _, prefix := range e.Prefixes {
+		prefixes = append(prefixes, prefix.String())
+	}
+	return fmt.Sprintf("%s %s %s", strings.Join(prefixes, ","), e.Substitute4, e.Substitute6)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+var fakeEpoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeClockAfter(t *testing.T) {
+	c := NewFakeClock(fakeEpoch)
+	ch := c.After(time.Second)
+
+	c.Advance(999 * time.Millisecond)
+	select {
+	case <-ch:
+		t.Fatal("fired before its deadline")
+	default:
+	}
+	c.Advance(time.Millisecond)
+	select {
+	case at := <-ch:
+		if !at.Equal(fakeEpoch.Add(time.Second)) {
+			t.Fatalf("fired at %s", at)
+		}
+	default:
+		t.Fatal("did not fire at its deadline")
+	}
+	if n := c.Waiters(); n != 0 {
+		t.Fatalf("%d waiter(s) left after firing", n)
+	}
+	if since := Since(c, fakeEpoch); since != time.Second {
+		t.Fatalf("expected 1s elapsed, got %s", since)
+	}
+}
+
+func TestFakeClockTicker(t *testing.T) {
+	c := NewFakeClock(fakeEpoch)
+	ticker := c.NewTicker(time.Second)
+
+	// Unreceived ticks are dropped like with time.Ticker
+	c.Advance(3 * time.Second)
+	select {
+	case at := <-ticker.C():
+		if !at.Equal(fakeEpoch.Add(time.Second)) {
+			t.Fatalf("first tick at %s", at)
+		}
+	default:
+		t.Fatal("no tick after 3s")
+	}
+	select {
+	case <-ticker.C():
+		t.Fatal("dropped ticks were delivered")
+	default:
+	}
+
+	ticker.Stop()
+	c.Advance(time.Minute)
+	select {
+	case <-ticker.C():
+		t.Fatal("stopped ticker ticked")
+	default:
+	}
+}
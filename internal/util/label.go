@@ -0,0 +1,42 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CheckLabel verifies that a value read from a record source can be placed into a name as
+// part of a single label. A dot would place the name elsewhere in the namespace, e.g. in
+// the names of another node, and escapes, whitespace and control characters make names
+// that cannot be served, so such values are rejected rather than sanitized.
+func CheckLabel(value string) error {
+	if value == "" {
+		return errors.New("is empty")
+	}
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '.':
+			return errors.New("contains a dot")
+		case c == '\\':
+			return errors.New("contains an escape")
+		case c <= ' ' || c >= 0x7f:
+			return fmt.Errorf("contains invalid character %q", c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+)
+
+// ListenerRole maps the local addresses of a listener to the role whose addresses are
+// preferred in answers to queries arriving on it
+type ListenerRole struct {
+	Prefix *net.IPNet
+	Role   string
+}
+
+// ParseListenerRole parses a listener_role mapping of a local prefix to a role
+func ParseListenerRole(prefix, role string) (ListenerRole, error) {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return ListenerRole{}, fmt.Errorf("invalid listener_role prefix '%s'", prefix)
+	}
+	if !slices.Contains(RolesList, role) {
+		return ListenerRole{}, fmt.Errorf("unknown listener_role role '%s'", role)
+	}
+	return ListenerRole{Prefix: network, Role: role}, nil
+}
+
+// localIPKey is the context key of the local address a query arrived on
+type localIPKey struct{}
+
+// WithLocalIP returns ctx carrying the local address a query arrived on, for adapters
+// whose answers depend on the listener
+func WithLocalIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, localIPKey{}, net.ParseIP(ip))
+}
+
+// LocalIP returns the local address the query of ctx arrived on (nil if unknown)
+func LocalIP(ctx context.Context) net.IP {
+	ip, _ := ctx.Value(localIPKey{}).(net.IP)
+	return ip
+}
+
+// MatchListenerRole returns the role of the first mapping containing ip ("" for none)
+func MatchListenerRole(roles []ListenerRole, ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	for _, lr := range roles {
+		if lr.Prefix.Contains(ip) {
+			return lr.Role
+		}
+	}
+	return ""
+}
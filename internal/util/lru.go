@@ -0,0 +1,132 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+)
+
+// LRU is a size-bounded cache whose entries also expire after a fixed TTL.
+// It is safe for concurrent use. Every structure keyed by query name must be backed
+// by one, so that random names cannot grow memory without bound.
+type LRU[K comparable, V any] struct {
+	// Size is the maximum number of entries held
+	Size int
+	// TTL is how long an entry stays valid after being added
+	TTL time.Duration
+	// Name labels the cache's eviction metrics
+	Name string
+	// Clock is the source of time for expiry
+	Clock Clock
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+func NewLRU[K comparable, V any](name string, size int, ttl time.Duration) *LRU[K, V] {
+	return &LRU[K, V]{
+		Size:  size,
+		TTL:   ttl,
+		Name:  name,
+		Clock: RealClock,
+		ll:    list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value for key if present and not expired.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := el.Value.(*lruEntry[K, V])
+	if c.Clock.Now().After(entry.expires) {
+		c.removeElement(el)
+		metrics.CacheEvictions.WithLabelValues(c.Name, "expired").Inc()
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.value, true
+}
+
+// Add inserts or replaces the value for key, evicting the least recently used
+// entry if the cache is full.
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.Clock.Now().Add(c.TTL)
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry[K, V])
+		entry.value = value
+		entry.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruEntry[K, V]{key: key, value: value, expires: expires})
+	for c.Size > 0 && c.ll.Len() > c.Size {
+		c.removeElement(c.ll.Back())
+		metrics.CacheEvictions.WithLabelValues(c.Name, "size").Inc()
+	}
+}
+
+// Remove deletes key from the cache.
+func (c *LRU[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Purge deletes all entries.
+func (c *LRU[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	clear(c.items)
+}
+
+// Len returns the number of entries, including any not yet evicted after expiry.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *LRU[K, V]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry[K, V]).key)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestLRURandomNames fills a cache with 1M unique query names, as a random-label attack
+// would, and checks that it stays within its bound and counts every eviction
+func TestLRURandomNames(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+	const (
+		size  = 10000
+		names = 1_000_000
+		// maxHeapGrowth is generous for size entries of short names
+		maxHeapGrowth = 32 << 20
+	)
+	c := NewLRU[string, struct{}]("test_random_names", size, time.Minute)
+	evictions := metrics.CacheEvictions.WithLabelValues(c.Name, "size")
+	before := testutil.ToFloat64(evictions)
+
+	var start runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&start)
+	for i := range names {
+		c.Add(strconv.Itoa(i)+".random.pce.internal.", struct{}{})
+		if c.Len() > size {
+			t.Fatalf("cache grew to %d entries, over its size of %d", c.Len(), size)
+		}
+	}
+	var end runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&end)
+
+	if len(c.items) != size || c.ll.Len() != size {
+		t.Fatalf("expected %d entries, got %d in the map and %d in the list", size, len(c.items), c.ll.Len())
+	}
+	if got := testutil.ToFloat64(evictions) - before; got != names-size {
+		t.Fatalf("expected %d evictions, counted %.0f", names-size, got)
+	}
+	if growth := int64(end.HeapAlloc) - int64(start.HeapAlloc); growth > maxHeapGrowth {
+		t.Fatalf("heap grew by %d bytes, over the bound of %d", growth, maxHeapGrowth)
+	}
+	// The most recent names are kept
+	if _, ok := c.Get(strconv.Itoa(names-1) + ".random.pce.internal."); !ok {
+		t.Fatal("most recently added name was evicted")
+	}
+	if _, ok := c.Get("0.random.pce.internal."); ok {
+		t.Fatal("oldest name was kept")
+	}
+	runtime.KeepAlive(c)
+}
+
+func TestLRUExpiry(t *testing.T) {
+	clock := NewFakeClock(fakeEpoch)
+	c := NewLRU[string, int]("test_expiry", 10, time.Minute)
+	c.Clock = clock
+	evictions := metrics.CacheEvictions.WithLabelValues(c.Name, "expired")
+	before := testutil.ToFloat64(evictions)
+
+	c.Add("a.", 1)
+	clock.Advance(time.Minute)
+	if v, ok := c.Get("a."); !ok || v != 1 {
+		t.Fatalf("entry expired at its TTL: %d, %t", v, ok)
+	}
+	clock.Advance(time.Nanosecond)
+	if _, ok := c.Get("a."); ok {
+		t.Fatal("entry served after its TTL")
+	}
+	if c.Len() != 0 {
+		t.Fatalf("expired entry kept, %d entries", c.Len())
+	}
+	if got := testutil.ToFloat64(evictions) - before; got != 1 {
+		t.Fatalf("expected 1 expiry eviction, counted %.0f", got)
+	}
+}
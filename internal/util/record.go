@@ -16,17 +16,29 @@ limitations under the License.
 package util
 
 import (
+	"encoding/hex"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 
 	"github.com/miekg/dns"
 )
 
+// Record sources
+const (
+	SourceDB     = "db"
+	SourceStatic = "static"
+)
+
 type Record struct {
 	FQDN    string
 	Type    uint16
 	TTL     uint32
 	Content RecordContent
+	// Source names the adapter that produced the record. It is for logs, metrics and
+	// debugging only and never appears in DNS answers.
+	Source string
 }
 type RecordContent struct {
 	// A/AAAA fields
@@ -35,14 +47,31 @@ type RecordContent struct {
 	// CNAME fields
 	CNAME string
 
-	// SRV fields
+	// SRV fields (Target also holds the NS name server and the PTR name)
 	Priority uint16
 	Weight   uint16
 	Port     uint16
 	Target   string
 
+	// SOA fields
+	SOA *SOAContent
+
 	// TXT fields
 	Data string
+
+	// RFC3597 carries the rdata of types without dedicated fields in the generic
+	// encoding of RFC 3597 (`\# <len> <hex>`). When set it takes precedence.
+	RFC3597 string
+}
+
+type SOAContent struct {
+	Mname   string
+	Rname   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minttl  uint32
 }
 
 func splitTxtData(content string) []string {
@@ -120,8 +149,96 @@ func (r *Record) AsTXTRecord() (dns.RR, error) {
 	}
 	return rr, nil
 }
+func (r *Record) AsNSRecord() (dns.RR, error) {
+	rr := &dns.NS{
+		Hdr: dns.RR_Header{
+			Name:   r.FQDN,
+			Rrtype: dns.TypeNS,
+			Class:  dns.ClassINET,
+			Ttl:    r.TTL,
+		},
+		Ns: dns.CanonicalName(r.Content.Target),
+	}
+	return rr, nil
+}
+func (r *Record) AsPTRRecord() (dns.RR, error) {
+	rr := &dns.PTR{
+		Hdr: dns.RR_Header{
+			Name:   r.FQDN,
+			Rrtype: dns.TypePTR,
+			Class:  dns.ClassINET,
+			Ttl:    r.TTL,
+		},
+		Ptr: dns.CanonicalName(r.Content.Target),
+	}
+	return rr, nil
+}
+func (r *Record) AsSOARecord() (dns.RR, error) {
+	soa := r.Content.SOA
+	if soa == nil {
+		return nil, fmt.Errorf("SOA record %q has no content", r.FQDN)
+	}
+	rr := &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   r.FQDN,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    r.TTL,
+		},
+		Ns:      dns.CanonicalName(soa.Mname),
+		Mbox:    dns.CanonicalName(soa.Rname),
+		Serial:  soa.Serial,
+		Refresh: soa.Refresh,
+		Retry:   soa.Retry,
+		Expire:  soa.Expire,
+		Minttl:  soa.Minttl,
+	}
+	return rr, nil
+}
+
+// parseRFC3597 decodes generic rdata (`\# <len> <hex>`), returning the rdata as hex
+func parseRFC3597(generic string) (string, error) {
+	fields := strings.Fields(generic)
+	if len(fields) < 2 || fields[0] != `\#` {
+		return "", fmt.Errorf("invalid generic rdata %q", generic)
+	}
+	length, err := strconv.Atoi(fields[1])
+	if err != nil || length < 0 || length > 0xFFFF {
+		return "", fmt.Errorf("invalid generic rdata length %q", fields[1])
+	}
+	// The hex data may be split into several words
+	data := strings.Join(fields[2:], "")
+	raw, err := hex.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("invalid generic rdata: %w", err)
+	}
+	if len(raw) != length {
+		return "", fmt.Errorf("generic rdata length is %d, expected %d", len(raw), length)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+func (r *Record) AsRFC3597Record() (dns.RR, error) {
+	rdata, err := parseRFC3597(r.Content.RFC3597)
+	if err != nil {
+		return nil, err
+	}
+	rr := &dns.RFC3597{
+		Hdr: dns.RR_Header{
+			Name:   r.FQDN,
+			Rrtype: r.Type,
+			Class:  dns.ClassINET,
+			Ttl:    r.TTL,
+		},
+		Rdata: rdata,
+	}
+	return rr, nil
+}
 
 func recordToRR(record *Record) (dns.RR, error) {
+	if record.Content.RFC3597 != "" {
+		return record.AsRFC3597Record()
+	}
 	switch record.Type {
 	case dns.TypeA:
 		return record.AsARecord()
@@ -133,6 +250,12 @@ func recordToRR(record *Record) (dns.RR, error) {
 		return record.AsSRVRecord()
 	case dns.TypeTXT:
 		return record.AsTXTRecord()
+	case dns.TypeNS:
+		return record.AsNSRecord()
+	case dns.TypePTR:
+		return record.AsPTRRecord()
+	case dns.TypeSOA:
+		return record.AsSOARecord()
 	default:
 		return nil, fmt.Errorf("unsupported record type: %d", record.Type)
 	}
@@ -149,3 +272,59 @@ func RecordsToRRs(records []Record) ([]dns.RR, error) {
 	}
 	return answers, nil
 }
+
+// FilterAddresses returns the A/AAAA records owned by any of names
+func FilterAddresses(records []Record, names []string) []Record {
+	wanted := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		wanted[dns.CanonicalName(name)] = struct{}{}
+	}
+
+	var results []Record
+	for _, record := range records {
+		if record.Type != dns.TypeA && record.Type != dns.TypeAAAA {
+			continue
+		}
+		if _, ok := wanted[record.FQDN]; ok {
+			results = append(results, record)
+		}
+	}
+	return results
+}
+
+// FilterByIP returns the A/AAAA records of ip
+func FilterByIP(records []Record, ip net.IP) []Record {
+	var results []Record
+	for _, record := range records {
+		if (record.Type == dns.TypeA || record.Type == dns.TypeAAAA) && record.Content.IP.Equal(ip) {
+			results = append(results, record)
+		}
+	}
+	return results
+}
+
+// MatchRecords returns the records owned by name that answer qtype, and whether name owns
+// any records at all. The semantics are shared by every adapter:
+//   - A and AAAA match their own type only, so families never mix
+//   - ANY matches every record at the name, without any CNAME special casing
+//   - a CNAME at the name is returned for A and AAAA queries, so clients can follow it.
+//     Loaders drop other data at CNAME owners (EnforceCNAMEExclusivity), so it is
+//     never mixed with address records.
+func MatchRecords(records []Record, name string, qtype uint16) ([]Record, bool) {
+	var results []Record
+	nameExists := false
+	for _, record := range records {
+		if record.FQDN != name {
+			continue
+		}
+		nameExists = true
+
+		switch {
+		case qtype == dns.TypeANY || record.Type == qtype:
+			results = append(results, record)
+		case (qtype == dns.TypeA || qtype == dns.TypeAAAA) && record.Type == dns.TypeCNAME:
+			results = append(results, record)
+		}
+	}
+	return results, nameExists
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import "sync"
+
+// InstanceRegistry tracks the live instance for each config fingerprint. On a reload the
+// new instances are set up before the old ones shut down, so a new instance can find its
+// predecessor here and adopt its state instead of starting cold.
+type InstanceRegistry[T comparable] struct {
+	mu    sync.Mutex
+	byKey map[string]T
+}
+
+// Replace registers inst under key, returning the instance it replaces, if any
+func (r *InstanceRegistry[T]) Replace(key string, inst T) (T, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byKey == nil {
+		r.byKey = map[string]T{}
+	}
+	prev, ok := r.byKey[key]
+	r.byKey[key] = inst
+	return prev, ok && prev != inst
+}
+
+// Remove unregisters inst, unless it was already replaced
+func (r *InstanceRegistry[T]) Remove(key string, inst T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byKey[key] == inst {
+		delete(r.byKey, key)
+	}
+}
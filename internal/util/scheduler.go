@@ -0,0 +1,131 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+)
+
+// DefaultSchedulerJitter spreads job runs by ±10% of their interval
+const DefaultSchedulerJitter = 0.1
+
+// Scheduler runs named periodic jobs with jittered intervals on a bounded number of
+// workers, so that background loops do not align and hit the database together.
+type Scheduler struct {
+	clock Clock
+	// workers bounds the number of jobs running at once
+	workers chan struct{}
+
+	mu      sync.Mutex
+	stop    chan struct{}
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func NewScheduler(clock Clock, workers int) *Scheduler {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Scheduler{
+		clock:   clock,
+		workers: make(chan struct{}, workers),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Every runs fn every interval, randomized by ±jitter (a fraction of interval), until the
+// returned cancel func or Stop is called. The first run happens after one interval.
+func (s *Scheduler) Every(name string, interval time.Duration, jitter float64, fn func() error) (cancel func()) {
+	return s.every(name, interval, jitter, fn, s.workers)
+}
+
+// EveryDedicated is Every for a job running on its own worker rather than the shared
+// ones, for jobs that can take long enough to hold up the others, e.g. network probes
+func (s *Scheduler) EveryDedicated(name string, interval time.Duration, jitter float64, fn func() error) (cancel func()) {
+	return s.every(name, interval, jitter, fn, make(chan struct{}, 1))
+}
+
+func (s *Scheduler) every(name string, interval time.Duration, jitter float64, fn func() error, workers chan struct{}) (cancel func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-s.clock.After(jitterDuration(interval, jitter)):
+			case <-done:
+				return
+			case <-s.stop:
+				return
+			}
+			select {
+			case workers <- struct{}{}:
+			case <-done:
+				return
+			case <-s.stop:
+				return
+			}
+			s.run(name, fn)
+			<-workers
+		}
+	}()
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func (s *Scheduler) run(name string, fn func() error) {
+	start := s.clock.Now()
+	err := fn()
+	metrics.SchedulerJobDuration.WithLabelValues(name).Observe(Since(s.clock, start).Seconds())
+	metrics.SchedulerLastRun.WithLabelValues(name).Set(float64(start.Unix()))
+	if err != nil {
+		ilog.Log.Warningf("scheduler: job %s failed: %v", name, err)
+		metrics.SchedulerLastError.WithLabelValues(name).Set(1)
+		return
+	}
+	metrics.SchedulerLastError.WithLabelValues(name).Set(0)
+}
+
+// Stop cancels every job and waits for running ones to finish. It is safe to call more
+// than once.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// jitterDuration randomizes d by ±jitter of its length
+func jitterDuration(d time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + (rand.Float64()*2-1)*jitter))
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSchedulerEvery(t *testing.T) {
+	c := NewFakeClock(fakeEpoch)
+	s := NewScheduler(c, 1)
+	defer s.Stop()
+
+	runs := make(chan time.Time)
+	cancel := s.Every("test", time.Minute, 0, func() error {
+		runs <- c.Now()
+		return errors.New("failing jobs keep running")
+	})
+
+	for i := 1; i <= 3; i++ {
+		c.BlockUntil(1)
+		c.Advance(time.Minute)
+		if at := <-runs; !at.Equal(fakeEpoch.Add(time.Duration(i) * time.Minute)) {
+			t.Fatalf("run %d at %s", i, at)
+		}
+	}
+
+	cancel()
+	c.BlockUntil(1)
+	c.Advance(time.Hour)
+	select {
+	case <-runs:
+		t.Fatal("job ran after cancel")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestSchedulerStop(t *testing.T) {
+	c := NewFakeClock(fakeEpoch)
+	s := NewScheduler(c, 1)
+	s.Every("test", time.Minute, 0, func() error {
+		t.Error("job ran after Stop")
+		return nil
+	})
+	c.BlockUntil(1)
+	s.Stop()
+	c.Advance(time.Hour)
+
+	// Jobs added after Stop never run
+	s.Every("late", time.Minute, 0, func() error {
+		t.Error("job added after Stop ran")
+		return nil
+	})
+	c.Advance(time.Hour)
+}
+
+func TestSchedulerDedicated(t *testing.T) {
+	c := NewFakeClock(fakeEpoch)
+	s := NewScheduler(c, 1)
+	defer s.Stop()
+
+	// The slow job never finishes its first run while the shared one keeps running
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	s.EveryDedicated("slow", time.Minute, 0, func() error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	runs := make(chan time.Time)
+	s.Every("shared", time.Minute, 0, func() error {
+		runs <- c.Now()
+		return nil
+	})
+
+	c.BlockUntil(2)
+	c.Advance(time.Minute)
+	<-started
+	for i := 1; i <= 3; i++ {
+		if i > 1 {
+			c.BlockUntil(1)
+			c.Advance(time.Minute)
+		}
+		select {
+		case at := <-runs:
+			if !at.Equal(fakeEpoch.Add(time.Duration(i) * time.Minute)) {
+				t.Fatalf("run %d at %s", i, at)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("shared job starved at run %d", i)
+		}
+	}
+}
+
+func TestJitterDuration(t *testing.T) {
+	for range 1000 {
+		if d := jitterDuration(time.Minute, 0.1); d < 54*time.Second || d > 66*time.Second {
+			t.Fatalf("jittered duration %s out of ±10%%", d)
+		}
+	}
+	if d := jitterDuration(time.Minute, 0); d != time.Minute {
+		t.Fatalf("expected no jitter, got %s", d)
+	}
+}
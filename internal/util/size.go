@@ -0,0 +1,61 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"unsafe"
+
+	ilog "github.com/PextraCloud/pce-coredns/internal/log"
+	"github.com/PextraCloud/pce-coredns/internal/metrics"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// recordOverhead is the fixed in-memory size of a Record, excluding the data it points to
+const recordOverhead = int64(unsafe.Sizeof(Record{}))
+
+// ApproxSize estimates the bytes held by a record set from string and address lengths
+// plus the fixed struct overhead.
+func ApproxSize(records []Record) int64 {
+	var size int64
+	for i := range records {
+		r := &records[i]
+		size += recordOverhead
+		size += int64(len(r.FQDN) + len(r.Content.IP) + len(r.Content.CNAME) + len(r.Content.Target) + len(r.Content.Data) + len(r.Content.RFC3597))
+	}
+	return size
+}
+
+// ReportRecordSet updates the size and per-type count gauges for a record set held by
+// source and warns when it exceeds softLimit bytes (0 for no limit).
+func ReportRecordSet(source string, records []Record, softLimit int64) {
+	counts := map[uint16]int{}
+	for _, r := range records {
+		counts[r.Type]++
+	}
+	// Drop series for types that are no longer present
+	metrics.Records.DeletePartialMatch(prometheus.Labels{"source": source})
+	for rtype, n := range counts {
+		metrics.Records.WithLabelValues(source, dns.TypeToString[rtype]).Set(float64(n))
+	}
+
+	size := ApproxSize(records)
+	metrics.RecordSetRecords.WithLabelValues(source).Set(float64(len(records)))
+	metrics.RecordSetBytes.WithLabelValues(source).Set(float64(size))
+	if softLimit > 0 && size > softLimit {
+		ilog.Log.Warningf("%s: record set holds ~%d bytes in %d record(s), over the soft limit of %d bytes", source, size, len(records), softLimit)
+	}
+}
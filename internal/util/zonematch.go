@@ -0,0 +1,81 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ZoneMatcher finds the most specific zone containing a name. The zones are compiled into
+// a trie of labels from the root, so a match walks the labels of the name once instead of
+// comparing it against every zone. It is immutable once built.
+type ZoneMatcher struct {
+	root zoneNode
+}
+
+type zoneNode struct {
+	children map[string]*zoneNode
+	// zone is set if a zone ends at this node
+	zone string
+}
+
+func NewZoneMatcher(zones []string) *ZoneMatcher {
+	m := &ZoneMatcher{}
+	for _, zone := range zones {
+		zone = dns.CanonicalName(zone)
+		node := &m.root
+		labels := dns.SplitDomainName(zone)
+		for i := len(labels) - 1; i >= 0; i-- {
+			child, ok := node.children[labels[i]]
+			if !ok {
+				if node.children == nil {
+					node.children = map[string]*zoneNode{}
+				}
+				child = &zoneNode{}
+				node.children[labels[i]] = child
+			}
+			node = child
+		}
+		node.zone = zone
+	}
+	return m
+}
+
+// MatchZone returns the most specific zone containing name, which must be canonical
+func (m *ZoneMatcher) MatchZone(name string) (string, bool) {
+	node := &m.root
+	match := node.zone
+	// Walk the labels from the right without allocating
+	end := len(name)
+	if strings.HasSuffix(name, ".") {
+		end--
+	}
+	for end > 0 {
+		start := strings.LastIndexByte(name[:end], '.') + 1
+		child, ok := node.children[name[start:end]]
+		if !ok {
+			break
+		}
+		node = child
+		if node.zone != "" {
+			match = node.zone
+		}
+		end = start - 1
+	}
+	return match, match != ""
+}
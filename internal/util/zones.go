@@ -15,10 +15,16 @@ limitations under the License.
 */
 package util
 
-import "context"
+import (
+	"context"
+	"net"
+)
 
 const zoneBase = "pce.internal."
 
+// MaxRecordTTL is the largest TTL served for records (one day)
+const MaxRecordTTL = 86400
+
 const ZoneDynamic = zoneBase
 const ZoneBootstrap = "bootstrap." + zoneBase
 
@@ -27,6 +33,41 @@ var ZonesList = []string{
 	ZoneBootstrap,
 }
 
+// Adapter serves records for a zone. Query names are passed canonical (lowercase, fully
+// qualified) and record FQDNs must be stored canonical, so adapters compare them as-is.
 type Adapter interface {
 	LookupRecords(ctx context.Context, qName string, qType uint16) ([]Record, bool, error)
 }
+
+// AddressAdapter is implemented by adapters that can return the A/AAAA records of several
+// names from a single load, e.g. for additional section glue.
+type AddressAdapter interface {
+	LookupAddresses(ctx context.Context, names []string) ([]Record, error)
+}
+
+// ReverseAdapter is implemented by adapters that can find the A/AAAA records of an
+// address, for reverse lookups.
+type ReverseAdapter interface {
+	LookupReverse(ctx context.Context, ip net.IP) ([]Record, error)
+}
+
+// Generational is implemented by adapters that can report changes to their record set.
+// The generation increases every time the set of records served changes.
+type Generational interface {
+	Generation() uint64
+}
+
+// Reasons reported by StaleAdapter
+const (
+	// StaleCache is reported while a cached record set is served after a failed refresh
+	StaleCache = "stale-cache"
+	// StaleSeeded is reported while records seeded from a snapshot are served
+	StaleSeeded = "seeded"
+)
+
+// StaleAdapter is implemented by adapters that can serve records their source has not
+// confirmed. Answers from such records are not authoritative.
+type StaleAdapter interface {
+	// Stale returns why the records served are unconfirmed, or "" if they are current
+	Stale() string
+}
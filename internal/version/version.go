@@ -0,0 +1,30 @@
+/*
+Copyright 2026 Pextra Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package version
+
+// Build information, set at build time with
+//
+//	-ldflags "-X github.com/PextraCloud/pce-coredns/internal/version.Version=<version>
+//	          -X github.com/PextraCloud/pce-coredns/internal/version.Commit=<commit>"
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
+// String describes the build, e.g. for logs and TXT answers
+func String() string {
+	return Version + " (" + Commit + ")"
+}
@@ -18,9 +18,34 @@ package pce_coredns
 import (
 	"github.com/PextraCloud/pce-coredns/internal/log"
 	pce "github.com/PextraCloud/pce-coredns/internal/plugin"
+	"github.com/PextraCloud/pce-coredns/internal/util"
+	"github.com/PextraCloud/pce-coredns/internal/version"
 	"github.com/coredns/caddy"
 )
 
+// Record is a record served by the plugin, as seen by filters
+type Record = util.Record
+
+// FilterFunc post-processes the records found for a query before they are answered
+type FilterFunc = pce.FilterFunc
+
+// NewSetup returns the setup function of plugin instances that run filters, in order,
+// over the records of every answer. Builds that post-process records register it under
+// their own directive, e.g. from an init function:
+//
+//	caddy.RegisterPlugin("pce_filtered", caddy.Plugin{
+//		ServerType: "dns",
+//		Action:     pce_coredns.NewSetup(filter),
+//	})
+func NewSetup(filters ...FilterFunc) caddy.SetupFunc {
+	return pce.NewSetup(filters...)
+}
+
+// Version returns the plugin version and commit, as set at build time
+func Version() (string, string) {
+	return version.Version, version.Commit
+}
+
 func init() {
 	caddy.RegisterPlugin(log.PluginName, caddy.Plugin{
 		ServerType: "dns",